@@ -26,6 +26,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -65,6 +66,23 @@ const (
 	// controllerName is a unique value used with LabelManagedBy to indicated
 	// the component managing an EndpointSlice.
 	controllerName = "endpointslicemirroring-controller.k8s.io"
+
+	// nativeControllerName is the LabelManagedBy value used by the native
+	// EndpointSlice controller, which reconciles Services directly without
+	// going through Endpoints.
+	nativeControllerName = "endpointslice-controller.k8s.io"
+
+	// defaultMaxEndpointsPerSubset is the maximum number of endpoints that
+	// will be mirrored per EndpointSubset when NewController is passed a
+	// maxEndpointsPerSubset of 0. A limit of 0 would mirror nothing and look
+	// like an outage.
+	defaultMaxEndpointsPerSubset = int32(1000)
+
+	// mirroringFinalizer is the finalizer added to mirrored Endpoints
+	// resources when finalizer management is enabled, so mirrored
+	// EndpointSlices can be cleaned up before the Endpoints object fully
+	// disappears.
+	mirroringFinalizer = "endpointslice.kubernetes.io/endpoints-mirrored"
 )
 
 // NewController creates and initializes a new Controller
@@ -82,22 +100,8 @@ func NewController(ctx context.Context, endpointsInformer coreinformers.Endpoint
 	metrics.RegisterMetrics()
 
 	c := &Controller{
-		client: client,
-		// This is similar to the DefaultControllerRateLimiter, just with a
-		// significantly higher default backoff (1s vs 5ms). This controller
-		// processes events that can require significant EndpointSlice changes.
-		// A more significant rate limit back off here helps ensure that the
-		// Controller does not overwhelm the API Server.
-		queue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.NewTypedMaxOfRateLimiter(
-			workqueue.NewTypedItemExponentialFailureRateLimiter[string](defaultSyncBackOff, maxSyncBackOff),
-			// 10 qps, 100 bucket size. This is only for retry speed and its
-			// only the overall factor (not per item).
-			&workqueue.TypedBucketRateLimiter[string]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
-		),
-			workqueue.TypedRateLimitingQueueConfig[string]{
-				Name: "endpoint_slice_mirroring",
-			},
-		),
+		client:           client,
+		queue:            newMirroringQueue("endpoint_slice_mirroring"),
 		workerLoopPeriod: time.Second,
 	}
 
@@ -135,6 +139,7 @@ func NewController(ctx context.Context, endpointsInformer coreinformers.Endpoint
 		DeleteFunc: c.onServiceDelete,
 	})
 
+	maxEndpointsPerSubset = clampMaxEndpointsPerSubset(logger, maxEndpointsPerSubset)
 	c.maxEndpointsPerSubset = maxEndpointsPerSubset
 
 	c.reconciler = &reconciler{
@@ -144,6 +149,7 @@ func NewController(ctx context.Context, endpointsInformer coreinformers.Endpoint
 		metricsCache:          metrics.NewCache(maxEndpointsPerSubset),
 		eventRecorder:         recorder,
 	}
+	c.reconciler.logEffectiveConfiguration(logger)
 
 	c.eventBroadcaster = broadcaster
 	c.eventRecorder = recorder
@@ -153,6 +159,38 @@ func NewController(ctx context.Context, endpointsInformer coreinformers.Endpoint
 	return c
 }
 
+// clampMaxEndpointsPerSubset returns maxEndpointsPerSubset clamped to a valid
+// positive range, logging if an out-of-range value was supplied. A limit of 0
+// or below would mirror nothing and look like an outage, while a limit above
+// what EndpointSlice validation permits would produce slices the apiserver
+// rejects.
+func clampMaxEndpointsPerSubset(logger klog.Logger, maxEndpointsPerSubset int32) int32 {
+	if maxEndpointsPerSubset <= 0 || maxEndpointsPerSubset > defaultMaxEndpointsPerSubset {
+		logger.Info("Clamping out-of-range maxEndpointsPerSubset", "maxEndpointsPerSubset", maxEndpointsPerSubset, "clampedTo", defaultMaxEndpointsPerSubset)
+		return defaultMaxEndpointsPerSubset
+	}
+	return maxEndpointsPerSubset
+}
+
+// newMirroringQueue returns a rate limited queue for Endpoints keys. This is
+// similar to the DefaultControllerRateLimiter, just with a significantly
+// higher default backoff (1s vs 5ms). This controller processes events that
+// can require significant EndpointSlice changes. A more significant rate
+// limit back off here helps ensure that the Controller does not overwhelm
+// the API Server.
+func newMirroringQueue(name string) workqueue.TypedRateLimitingInterface[string] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[string](defaultSyncBackOff, maxSyncBackOff),
+		// 10 qps, 100 bucket size. This is only for retry speed and its
+		// only the overall factor (not per item).
+		&workqueue.TypedBucketRateLimiter[string]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	),
+		workqueue.TypedRateLimitingQueueConfig[string]{
+			Name: name,
+		},
+	)
+}
+
 // Controller manages selector-based service endpoint slices
 type Controller struct {
 	client           clientset.Interface
@@ -198,6 +236,12 @@ type Controller struct {
 	// than necessary.
 	queue workqueue.TypedRateLimitingInterface[string]
 
+	// shardQueues, when non-empty, splits dispatch across one queue per
+	// worker so a given Endpoints key is always handled by the same worker.
+	// This reduces cross-worker contention on shared state such as the
+	// EndpointSliceTracker.
+	shardQueues []workqueue.TypedRateLimitingInterface[string]
+
 	// maxEndpointsPerSubset references the maximum number of endpoints that
 	// should be added to an EndpointSlice for an EndpointSubset.
 	maxEndpointsPerSubset int32
@@ -210,6 +254,15 @@ type Controller struct {
 	// syncs triggered by EndpointSlice changes. This can be used to reduce
 	// overall number of all EndpointSlice updates.
 	endpointUpdatesBatchPeriod time.Duration
+
+	// manageFinalizer indicates whether a finalizer should be added to
+	// mirrored Endpoints resources so mirrored EndpointSlices are cleaned up
+	// before the Endpoints object fully disappears.
+	manageFinalizer bool
+
+	// maxConcurrentReconciles, when set, caps the number of worker threads
+	// started by Run regardless of the workers argument.
+	maxConcurrentReconciles int
 }
 
 // Run will not return until stopCh is closed.
@@ -222,6 +275,9 @@ func (c *Controller) Run(ctx context.Context, workers int) {
 	defer c.eventBroadcaster.Shutdown()
 
 	defer c.queue.ShutDown()
+	for _, queue := range c.shardQueues {
+		defer queue.ShutDown()
+	}
 
 	logger := klog.FromContext(ctx)
 	logger.Info("Starting EndpointSliceMirroring controller")
@@ -231,50 +287,88 @@ func (c *Controller) Run(ctx context.Context, workers int) {
 		return
 	}
 
-	logger.V(2).Info("Starting worker threads", "total", workers)
-	for i := 0; i < workers; i++ {
-		go wait.Until(func() { c.worker(logger) }, c.workerLoopPeriod, ctx.Done())
+	if c.maxConcurrentReconciles > 0 && workers > c.maxConcurrentReconciles {
+		logger.V(2).Info("Capping worker threads", "requested", workers, "maxConcurrentReconciles", c.maxConcurrentReconciles)
+		workers = c.maxConcurrentReconciles
+	}
+
+	if len(c.shardQueues) > 0 {
+		logger.V(2).Info("Starting worker threads with affinity", "total", len(c.shardQueues))
+		for i := range c.shardQueues {
+			queue := c.shardQueues[i]
+			go wait.Until(func() { c.worker(logger, queue) }, c.workerLoopPeriod, ctx.Done())
+		}
+	} else {
+		logger.V(2).Info("Starting worker threads", "total", workers)
+		for i := 0; i < workers; i++ {
+			go wait.Until(func() { c.worker(logger, c.queue) }, c.workerLoopPeriod, ctx.Done())
+		}
 	}
 
 	<-ctx.Done()
 }
 
+// enableWorkerAffinity splits dispatch across the provided number of shard
+// queues so a given Endpoints key is always handled by the same worker. It
+// must be called before Run.
+func (c *Controller) enableWorkerAffinity(shards int) {
+	c.shardQueues = make([]workqueue.TypedRateLimitingInterface[string], shards)
+	for i := range c.shardQueues {
+		c.shardQueues[i] = newMirroringQueue(fmt.Sprintf("endpoint_slice_mirroring_shard_%d", i))
+	}
+}
+
+// queueForKey returns the queue a key should be dispatched to. With worker
+// affinity enabled, the same key always maps to the same shard queue.
+func (c *Controller) queueForKey(key string) workqueue.TypedRateLimitingInterface[string] {
+	if len(c.shardQueues) == 0 {
+		return c.queue
+	}
+	return c.shardQueues[shardForKey(key, len(c.shardQueues))]
+}
+
 // worker runs a worker thread that just dequeues items, processes them, and
 // marks them done. You may run as many of these in parallel as you wish; the
 // workqueue guarantees that they will not end up processing the same service
 // at the same time
-func (c *Controller) worker(logger klog.Logger) {
-	for c.processNextWorkItem(logger) {
+func (c *Controller) worker(logger klog.Logger, queue workqueue.TypedRateLimitingInterface[string]) {
+	for c.processNextWorkItem(logger, queue) {
 	}
 }
 
-func (c *Controller) processNextWorkItem(logger klog.Logger) bool {
-	cKey, quit := c.queue.Get()
+func (c *Controller) processNextWorkItem(logger klog.Logger, queue workqueue.TypedRateLimitingInterface[string]) bool {
+	cKey, quit := queue.Get()
 	if quit {
 		return false
 	}
-	defer c.queue.Done(cKey)
+	defer queue.Done(cKey)
 
 	err := c.syncEndpoints(logger, cKey)
-	c.handleErr(logger, err, cKey)
+	c.handleErr(logger, queue, err, cKey)
 
 	return true
 }
 
-func (c *Controller) handleErr(logger klog.Logger, err error, key string) {
+func (c *Controller) handleErr(logger klog.Logger, queue workqueue.TypedRateLimitingInterface[string], err error, key string) {
 	if err == nil {
-		c.queue.Forget(key)
+		queue.Forget(key)
 		return
 	}
 
-	if c.queue.NumRequeues(key) < maxRetries {
+	if queue.NumRequeues(key) < maxRetries {
 		logger.Info("Error mirroring EndpointSlices for Endpoints, retrying", "key", key, "err", err)
-		c.queue.AddRateLimited(key)
+		// Transient failures can carry a suggested requeue delay, e.g. from a
+		// rate-limited apiserver response. Prefer it over the default backoff.
+		if delay, ok := suggestedRequeueDelay(err); ok {
+			queue.AddAfter(key, delay)
+			return
+		}
+		queue.AddRateLimited(key)
 		return
 	}
 
 	logger.Info("Retry budget exceeded, dropping Endpoints out of the queue", "key", key, "err", err)
-	c.queue.Forget(key)
+	queue.Forget(key)
 	utilruntime.HandleError(err)
 }
 
@@ -303,6 +397,21 @@ func (c *Controller) syncEndpoints(logger klog.Logger, key string) error {
 		return err
 	}
 
+	// When finalizer management is enabled, deletion is observed via the
+	// deletion timestamp while the finalizer holds the Endpoints object.
+	// Clean up the mirrored EndpointSlices before releasing the finalizer.
+	// This must run before the shouldMirror check: an Endpoints that stopped
+	// being mirrorable after the finalizer was added still has to release it,
+	// or its deletion would never complete.
+	if c.manageFinalizer && endpoints.DeletionTimestamp != nil {
+		logger.V(4).Info("Endpoints is being deleted, cleaning up any mirrored EndpointSlices before removing finalizer", "endpoints", klog.KObj(endpoints))
+		c.endpointSliceTracker.DeleteService(namespace, name)
+		if err := c.deleteMirroredSlices(namespace, name); err != nil {
+			return err
+		}
+		return c.removeFinalizer(endpoints)
+	}
+
 	if !c.shouldMirror(endpoints) {
 		logger.V(4).Info("Endpoints should not be mirrored, cleaning up any mirrored EndpointSlices", "endpoints", klog.KRef(namespace, name))
 		c.endpointSliceTracker.DeleteService(namespace, name)
@@ -326,7 +435,7 @@ func (c *Controller) syncEndpoints(logger klog.Logger, key string) error {
 		return c.deleteMirroredSlices(namespace, name)
 	}
 
-	endpointSlices, err := endpointSlicesMirroredForService(c.endpointSliceLister, namespace, name)
+	endpointSlices, err := c.endpointSlicesForMirroring(namespace, name)
 	if err != nil {
 		return err
 	}
@@ -335,6 +444,12 @@ func (c *Controller) syncEndpoints(logger klog.Logger, key string) error {
 		return endpointslicepkg.NewStaleInformerCache("EndpointSlice informer cache is out of date")
 	}
 
+	if c.manageFinalizer {
+		if err := c.ensureFinalizer(endpoints); err != nil {
+			return err
+		}
+	}
+
 	err = c.reconciler.reconcile(logger, endpoints, endpointSlices)
 	if err != nil {
 		return err
@@ -343,6 +458,50 @@ func (c *Controller) syncEndpoints(logger klog.Logger, key string) error {
 	return nil
 }
 
+// hasMirroringFinalizer returns true if an Endpoints resource carries the
+// mirroring finalizer.
+func hasMirroringFinalizer(endpoints *v1.Endpoints) bool {
+	for _, finalizer := range endpoints.Finalizers {
+		if finalizer == mirroringFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureFinalizer adds the mirroring finalizer to an Endpoints resource if it
+// is not already present.
+func (c *Controller) ensureFinalizer(endpoints *v1.Endpoints) error {
+	if hasMirroringFinalizer(endpoints) {
+		return nil
+	}
+	updated := endpoints.DeepCopy()
+	updated.Finalizers = append(updated.Finalizers, mirroringFinalizer)
+	_, err := c.client.CoreV1().Endpoints(updated.Namespace).Update(context.TODO(), updated, metav1.UpdateOptions{})
+	return err
+}
+
+// removeFinalizer removes the mirroring finalizer from an Endpoints resource
+// once its mirrored EndpointSlices have been cleaned up.
+func (c *Controller) removeFinalizer(endpoints *v1.Endpoints) error {
+	finalizers := []string{}
+	found := false
+	for _, finalizer := range endpoints.Finalizers {
+		if finalizer == mirroringFinalizer {
+			found = true
+			continue
+		}
+		finalizers = append(finalizers, finalizer)
+	}
+	if !found {
+		return nil
+	}
+	updated := endpoints.DeepCopy()
+	updated.Finalizers = finalizers
+	_, err := c.client.CoreV1().Endpoints(updated.Namespace).Update(context.TODO(), updated, metav1.UpdateOptions{})
+	return err
+}
+
 // queueEndpoints queues the Endpoints resource for processing.
 func (c *Controller) queueEndpoints(obj interface{}) {
 	key, err := controller.KeyFunc(obj)
@@ -351,7 +510,7 @@ func (c *Controller) queueEndpoints(obj interface{}) {
 		return
 	}
 
-	c.queue.Add(key)
+	c.queueForKey(key).Add(key)
 }
 
 // shouldMirror returns true if an Endpoints resource should be mirrored by this
@@ -428,7 +587,10 @@ func (c *Controller) onEndpointsUpdate(logger klog.Logger, prevObj, obj interfac
 		utilruntime.HandleError(fmt.Errorf("onEndpointsUpdate() expected type v1.Endpoints, got %T, %T", prevObj, obj))
 		return
 	}
-	if !c.shouldMirror(endpoints) && !c.shouldMirror(prevEndpoints) {
+	// An Endpoints that is no longer mirrorable but still carries the
+	// mirroring finalizer must be synced anyway, so its deletion can clean up
+	// and release the finalizer.
+	if !c.shouldMirror(endpoints) && !c.shouldMirror(prevEndpoints) && !hasMirroringFinalizer(endpoints) {
 		logger.V(5).Info("Skipping mirroring", "endpoints", klog.KObj(endpoints))
 		return
 	}
@@ -517,7 +679,7 @@ func (c *Controller) queueEndpointsForEndpointSlice(endpointSlice *discovery.End
 		return
 	}
 
-	c.queue.AddAfter(key, c.endpointUpdatesBatchPeriod)
+	c.queueForKey(key).AddAfter(key, c.endpointUpdatesBatchPeriod)
 }
 
 // deleteMirroredSlices will delete and EndpointSlices that have been mirrored
@@ -532,6 +694,31 @@ func (c *Controller) deleteMirroredSlices(namespace, name string) error {
 	return c.reconciler.deleteEndpoints(namespace, name, endpointSlices)
 }
 
+// endpointSlicesForMirroring returns the EndpointSlices the reconciler should
+// consider for an Endpoints resource. When the reconciler adopts unmanaged
+// slices, slices for the same Service that carry no managed-by label at all
+// are included as well, so the adoption path in reconcile can see them.
+func (c *Controller) endpointSlicesForMirroring(namespace, name string) ([]*discovery.EndpointSlice, error) {
+	endpointSlices, err := endpointSlicesMirroredForService(c.endpointSliceLister, namespace, name)
+	if err != nil || !c.reconciler.adoptUnmanaged {
+		return endpointSlices, err
+	}
+
+	esLabelSelector := labels.Set(map[string]string{
+		discovery.LabelServiceName: name,
+	}).AsSelectorPreValidated()
+	serviceSlices, err := c.endpointSliceLister.EndpointSlices(namespace).List(esLabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, endpointSlice := range serviceSlices {
+		if endpointSlice.Labels[discovery.LabelManagedBy] == "" {
+			endpointSlices = append(endpointSlices, endpointSlice)
+		}
+	}
+	return endpointSlices, nil
+}
+
 // endpointSlicesMirroredForService returns the EndpointSlices that have been
 // mirrored for a Service by this controller.
 func endpointSlicesMirroredForService(endpointSliceLister discoverylisters.EndpointSliceLister, namespace, name string) ([]*discovery.EndpointSlice, error) {
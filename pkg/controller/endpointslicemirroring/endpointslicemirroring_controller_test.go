@@ -470,6 +470,303 @@ func TestEndpointSlicesMirroredForService(t *testing.T) {
 	}
 }
 
+// TestEndpointSlicesForMirroring ensures unmanaged slices for a Service are
+// only selected for reconciliation when the reconciler adopts them.
+func TestEndpointSlicesForMirroring(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		adoptUnmanaged bool
+		endpointSlice  *discovery.EndpointSlice
+		expectedInList bool
+	}{{
+		testName:       "Managed EndpointSlice without adoption",
+		adoptUnmanaged: false,
+		endpointSlice: &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-1",
+				Namespace: "ns1",
+				Labels: map[string]string{
+					discovery.LabelServiceName: "svc1",
+					discovery.LabelManagedBy:   controllerName,
+				},
+			},
+		},
+		expectedInList: true,
+	}, {
+		testName:       "Unmanaged EndpointSlice without adoption",
+		adoptUnmanaged: false,
+		endpointSlice: &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-1",
+				Namespace: "ns1",
+				Labels: map[string]string{
+					discovery.LabelServiceName: "svc1",
+				},
+			},
+		},
+		expectedInList: false,
+	}, {
+		testName:       "Unmanaged EndpointSlice with adoption",
+		adoptUnmanaged: true,
+		endpointSlice: &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-1",
+				Namespace: "ns1",
+				Labels: map[string]string{
+					discovery.LabelServiceName: "svc1",
+				},
+			},
+		},
+		expectedInList: true,
+	}, {
+		testName:       "EndpointSlice managed by another controller with adoption",
+		adoptUnmanaged: true,
+		endpointSlice: &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-1",
+				Namespace: "ns1",
+				Labels: map[string]string{
+					discovery.LabelServiceName: "svc1",
+					discovery.LabelManagedBy:   controllerName + "foo",
+				},
+			},
+		},
+		expectedInList: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			_, c := newController(ctx, time.Duration(0))
+			c.reconciler.adoptUnmanaged = tc.adoptUnmanaged
+
+			err := c.endpointSliceStore.Add(tc.endpointSlice)
+			if err != nil {
+				t.Fatalf("Error adding EndpointSlice to store: %v", err)
+			}
+
+			endpointSlices, err := c.endpointSlicesForMirroring("ns1", "svc1")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if tc.expectedInList && len(endpointSlices) != 1 {
+				t.Fatalf("Expected 1 EndpointSlice to be in list, got %d", len(endpointSlices))
+			}
+			if !tc.expectedInList && len(endpointSlices) != 0 {
+				t.Fatalf("Expected no EndpointSlices to be in list, got %d", len(endpointSlices))
+			}
+		})
+	}
+}
+
+// TestSyncEndpointsFinalizer ensures that, with finalizer management enabled,
+// the finalizer is added on first sync and mirrored EndpointSlices are cleaned
+// up before the finalizer is removed on deletion.
+func TestSyncEndpointsFinalizer(t *testing.T) {
+	endpointsName := "testing-finalizer"
+	namespace := metav1.NamespaceDefault
+	_, ctx := ktesting.NewTestContext(t)
+	client, esController := newController(ctx, time.Duration(0))
+	esController.manageFinalizer = true
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: endpointsName, Namespace: namespace},
+	}
+	esController.serviceStore.Add(service)
+
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: endpointsName, Namespace: namespace},
+		Subsets: []v1.EndpointSubset{{
+			Ports:     []v1.EndpointPort{{Port: 80}},
+			Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}},
+		}},
+	}
+	esController.endpointsStore.Add(endpoints)
+	_, err := client.CoreV1().Endpoints(namespace).Create(context.TODO(), endpoints, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating Endpoints, got %v", err)
+	}
+
+	logger, _ := ktesting.NewTestContext(t)
+	key := fmt.Sprintf("%s/%s", namespace, endpointsName)
+	if err := esController.syncEndpoints(logger, key); err != nil {
+		t.Fatalf("Unexpected error from syncEndpoints: %v", err)
+	}
+
+	updatedEndpoints, err := client.CoreV1().Endpoints(namespace).Get(context.TODO(), endpointsName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error fetching Endpoints, got %v", err)
+	}
+	hasFinalizer := false
+	for _, finalizer := range updatedEndpoints.Finalizers {
+		if finalizer == mirroringFinalizer {
+			hasFinalizer = true
+		}
+	}
+	if !hasFinalizer {
+		t.Fatalf("Expected finalizer %s to be added on first sync, got %v", mirroringFinalizer, updatedEndpoints.Finalizers)
+	}
+
+	// Simulate deletion: the finalizer holds the object while the deletion
+	// timestamp is set.
+	deletedEndpoints := updatedEndpoints.DeepCopy()
+	deletionTimestamp := metav1.Now()
+	deletedEndpoints.DeletionTimestamp = &deletionTimestamp
+	esController.endpointsStore.Update(deletedEndpoints)
+
+	for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+		esController.endpointSliceStore.Add(epSlice.DeepCopy())
+	}
+
+	client.ClearActions()
+	if err := esController.syncEndpoints(logger, key); err != nil {
+		t.Fatalf("Unexpected error from syncEndpoints: %v", err)
+	}
+
+	sawSliceDelete := false
+	for _, action := range client.Actions() {
+		if action.Matches("delete", "endpointslices") {
+			sawSliceDelete = true
+		}
+		if action.Matches("update", "endpoints") && !sawSliceDelete {
+			t.Errorf("Expected mirrored EndpointSlices to be deleted before the finalizer was removed")
+		}
+	}
+	if !sawSliceDelete {
+		t.Errorf("Expected mirrored EndpointSlices to be deleted on Endpoints deletion")
+	}
+
+	finalEndpoints, err := client.CoreV1().Endpoints(namespace).Get(context.TODO(), endpointsName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error fetching Endpoints, got %v", err)
+	}
+	for _, finalizer := range finalEndpoints.Finalizers {
+		if finalizer == mirroringFinalizer {
+			t.Errorf("Expected finalizer %s to be removed after cleanup, got %v", mirroringFinalizer, finalEndpoints.Finalizers)
+		}
+	}
+}
+
+// TestSyncEndpointsFinalizerSkipMirror ensures an Endpoints that stopped
+// being mirrorable while still carrying the mirroring finalizer releases the
+// finalizer on deletion rather than staying stuck in Terminating.
+func TestSyncEndpointsFinalizerSkipMirror(t *testing.T) {
+	endpointsName := "testing-finalizer-skip"
+	namespace := metav1.NamespaceDefault
+	_, ctx := ktesting.NewTestContext(t)
+	client, esController := newController(ctx, time.Duration(0))
+	esController.manageFinalizer = true
+
+	deletionTimestamp := metav1.Now()
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              endpointsName,
+			Namespace:         namespace,
+			Labels:            map[string]string{discovery.LabelSkipMirror: "true"},
+			Finalizers:        []string{mirroringFinalizer},
+			DeletionTimestamp: &deletionTimestamp,
+		},
+	}
+	esController.endpointsStore.Add(endpoints)
+	_, err := client.CoreV1().Endpoints(namespace).Create(context.TODO(), endpoints, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating Endpoints, got %v", err)
+	}
+
+	logger, _ := ktesting.NewTestContext(t)
+	key := fmt.Sprintf("%s/%s", namespace, endpointsName)
+	if err := esController.syncEndpoints(logger, key); err != nil {
+		t.Fatalf("Unexpected error from syncEndpoints: %v", err)
+	}
+
+	finalEndpoints, err := client.CoreV1().Endpoints(namespace).Get(context.TODO(), endpointsName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error fetching Endpoints, got %v", err)
+	}
+	if hasMirroringFinalizer(finalEndpoints) {
+		t.Errorf("Expected finalizer %s to be removed from a non-mirrorable Endpoints being deleted, got %v", mirroringFinalizer, finalEndpoints.Finalizers)
+	}
+}
+
+// TestNewControllerDefaultsMaxEndpointsPerSubset ensures out-of-range
+// maxEndpointsPerSubset values are clamped to the default rather than
+// silently mirroring nothing or producing slices the apiserver rejects.
+func TestNewControllerDefaultsMaxEndpointsPerSubset(t *testing.T) {
+	testCases := []struct {
+		testName              string
+		maxEndpointsPerSubset int32
+		expectedMax           int32
+	}{{
+		testName:              "in range",
+		maxEndpointsPerSubset: 100,
+		expectedMax:           100,
+	}, {
+		testName:              "zero",
+		maxEndpointsPerSubset: 0,
+		expectedMax:           defaultMaxEndpointsPerSubset,
+	}, {
+		testName:              "negative",
+		maxEndpointsPerSubset: -10,
+		expectedMax:           defaultMaxEndpointsPerSubset,
+	}, {
+		testName:              "above EndpointSlice limit",
+		maxEndpointsPerSubset: defaultMaxEndpointsPerSubset + 1,
+		expectedMax:           defaultMaxEndpointsPerSubset,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			client := newClientset()
+			informerFactory := informers.NewSharedInformerFactory(client, controller.NoResyncPeriodFunc())
+
+			esController := NewController(
+				ctx,
+				informerFactory.Core().V1().Endpoints(),
+				informerFactory.Discovery().V1().EndpointSlices(),
+				informerFactory.Core().V1().Services(),
+				tc.maxEndpointsPerSubset,
+				client,
+				time.Duration(0))
+
+			if esController.maxEndpointsPerSubset != tc.expectedMax {
+				t.Errorf("Expected maxEndpointsPerSubset %d, got %d", tc.expectedMax, esController.maxEndpointsPerSubset)
+			}
+			if esController.reconciler.maxEndpointsPerSubset != tc.expectedMax {
+				t.Errorf("Expected reconciler maxEndpointsPerSubset %d, got %d", tc.expectedMax, esController.reconciler.maxEndpointsPerSubset)
+			}
+		})
+	}
+}
+
+// TestWorkerAffinity ensures that a given Endpoints key consistently maps to
+// the same shard queue when worker affinity is enabled.
+func TestWorkerAffinity(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	_, c := newController(ctx, time.Duration(0))
+	shards := 4
+	c.enableWorkerAffinity(shards)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("ns-%d/ep-%d", i%10, i)
+		shard := shardForKey(key, shards)
+		if shard < 0 || shard >= shards {
+			t.Fatalf("Expected shard for %s to be in [0, %d), got %d", key, shards, shard)
+		}
+
+		expectedQueue := c.queueForKey(key)
+		for j := 0; j < 10; j++ {
+			if got := c.queueForKey(key); got != expectedQueue {
+				t.Errorf("Expected key %s to consistently map to the same shard queue", key)
+			}
+			if got := shardForKey(key, shards); got != shard {
+				t.Errorf("Expected key %s to consistently map to shard %d, got %d", key, shard, got)
+			}
+		}
+	}
+}
+
 func generateAddresses(num int) []v1.EndpointAddress {
 	addresses := make([]v1.EndpointAddress, num)
 	for i := 0; i < num; i++ {
@@ -26,8 +26,35 @@ const (
 	// InvalidIPAddress indicates that an IP address found in an Endpoints
 	// resource is invalid.
 	InvalidIPAddress = "InvalidIPAddress"
+	// EmptyIPAddress indicates that an address found in an Endpoints resource
+	// has an empty IP.
+	EmptyIPAddress = "EmptyIPAddress"
 	// TooManyAddressesToMirror indicates that some addresses were not mirrored
 	// due to an EndpointSubset containing more addresses to mirror than
 	// MaxEndpointsPerSubset allows.
 	TooManyAddressesToMirror = "TooManyAddressesToMirror"
+	// TooManySubsets indicates that an Endpoints resource has more subsets
+	// than the configured maximum and only a prefix of them was mirrored.
+	TooManySubsets = "TooManySubsets"
+	// SyncSummary summarizes the EndpointSlice changes made while mirroring an
+	// Endpoints resource in a single reconcile.
+	SyncSummary = "SyncSummary"
+	// SlicePlan reports the EndpointSlice actions a reconcile computed before
+	// applying them, for live debugging.
+	SlicePlan = "SlicePlan"
+	// SliceRecycled indicates that an EndpointSlice marked for deletion was
+	// repurposed to hold newly generated content under its existing name.
+	SliceRecycled = "SliceRecycled"
+	// PortNameConflict indicates that a named port in an Endpoints resource
+	// maps to different numbers across subsets.
+	PortNameConflict = "PortNameConflict"
+	// EventBudgetExceeded indicates that a reconcile emitted more events than
+	// its configured budget and the remainder were suppressed.
+	EventBudgetExceeded = "EventBudgetExceeded"
+	// PortNotInService indicates that a port found in an Endpoints resource is
+	// not declared on the corresponding Service.
+	PortNotInService = "PortNotInService"
+	// SignificantShrink indicates that a single sync reduced the number of
+	// endpoints in an EndpointSlice by more than the configured percentage.
+	SignificantShrink = "SignificantShrink"
 )
@@ -29,6 +29,8 @@ func NewCache(endpointsPerSlice int32) *Cache {
 	return &Cache{
 		maxEndpointsPerSlice: endpointsPerSlice,
 		cache:                map[types.NamespacedName]*EndpointPortCache{},
+		zones:                map[types.NamespacedName]map[string]int{},
+		zoneTotals:           map[string]int{},
 	}
 }
 
@@ -47,12 +49,21 @@ type Cache struct {
 	// cache stores a EndpointPortCache grouped by NamespacedNames representing
 	// Services.
 	cache map[types.NamespacedName]*EndpointPortCache
+	// zones stores per-zone desired endpoint counts grouped by NamespacedNames
+	// representing Endpoints resources.
+	zones map[types.NamespacedName]map[string]int
+	// zoneTotals holds the aggregated per-zone counts currently reflected in
+	// the ZoneDistribution metric, so series for emptied zones can be removed.
+	zoneTotals map[string]int
 }
 
 // EndpointPortCache tracks values for total numbers of desired endpoints as well
 // as the efficiency of EndpointSlice endpoints distribution for each unique
 // Service Port combination.
 type EndpointPortCache struct {
+	// lock protects changes to items so an EndpointPortCache can be shared
+	// across concurrent reconciles.
+	lock  sync.RWMutex
 	items map[endpointsliceutil.PortMapKey]EfficiencyInfo
 }
 
@@ -74,12 +85,16 @@ func NewEndpointPortCache() *EndpointPortCache {
 // Set updates the EndpointPortCache to contain the provided EfficiencyInfo
 // for the provided PortMapKey.
 func (spc *EndpointPortCache) Set(pmKey endpointsliceutil.PortMapKey, eInfo EfficiencyInfo) {
+	spc.lock.Lock()
+	defer spc.lock.Unlock()
 	spc.items[pmKey] = eInfo
 }
 
 // numEndpoints returns the total number of endpoints represented by a
 // EndpointPortCache.
 func (spc *EndpointPortCache) numEndpoints() int {
+	spc.lock.RLock()
+	defer spc.lock.RUnlock()
 	num := 0
 	for _, eInfo := range spc.items {
 		num += eInfo.Endpoints
@@ -110,6 +125,17 @@ func (c *Cache) UpdateEndpointPortCache(endpointsNN types.NamespacedName, epCach
 	c.updateMetrics()
 }
 
+// UpdateZoneDistribution replaces the per-zone desired endpoint counts tracked
+// for an Endpoints resource and refreshes the ZoneDistribution metric from the
+// counts aggregated across all tracked resources.
+func (c *Cache) UpdateZoneDistribution(endpointsNN types.NamespacedName, endpointsPerZone map[string]int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.zones[endpointsNN] = endpointsPerZone
+	c.updateZoneMetrics()
+}
+
 // DeleteEndpoints removes references to an Endpoints resource from the global
 // cache and updates the corresponding metrics.
 func (c *Cache) DeleteEndpoints(endpointsNN types.NamespacedName) {
@@ -121,6 +147,10 @@ func (c *Cache) DeleteEndpoints(endpointsNN types.NamespacedName) {
 		delete(c.cache, endpointsNN)
 		c.updateMetrics()
 	}
+	if _, ok := c.zones[endpointsNN]; ok {
+		delete(c.zones, endpointsNN)
+		c.updateZoneMetrics()
+	}
 }
 
 // metricsUpdate stores a desired and actual number of EndpointSlices.
@@ -134,10 +164,12 @@ type metricsUpdate struct {
 func (c *Cache) desiredAndActualSlices() metricsUpdate {
 	mUpdate := metricsUpdate{}
 	for _, spCache := range c.cache {
+		spCache.lock.RLock()
 		for _, eInfo := range spCache.items {
 			mUpdate.actual += eInfo.Slices
 			mUpdate.desired += numDesiredSlices(eInfo.Endpoints, int(c.maxEndpointsPerSlice))
 		}
+		spCache.lock.RUnlock()
 	}
 	return mUpdate
 }
@@ -151,6 +183,28 @@ func (c *Cache) updateMetrics() {
 	EndpointsDesired.WithLabelValues().Set(float64(c.numEndpoints))
 }
 
+// updateZoneMetrics recomputes the ZoneDistribution metric from the per-zone
+// counts of every tracked Endpoints resource, removing series for zones that
+// no longer back any endpoint.
+// Must be called holding lock.
+func (c *Cache) updateZoneMetrics() {
+	totals := map[string]int{}
+	for _, endpointsPerZone := range c.zones {
+		for zone, count := range endpointsPerZone {
+			totals[zone] += count
+		}
+	}
+	for zone, count := range totals {
+		ZoneDistribution.WithLabelValues(zone).Set(float64(count))
+	}
+	for zone := range c.zoneTotals {
+		if _, ok := totals[zone]; !ok {
+			ZoneDistribution.DeleteLabelValues(zone)
+		}
+	}
+	c.zoneTotals = totals
+}
+
 // numDesiredSlices calculates the number of EndpointSlices that would exist
 // with ideal endpoint distribution.
 func numDesiredSlices(numEndpoints, maxPerSlice int) int {
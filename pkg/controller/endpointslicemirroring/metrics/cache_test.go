@@ -17,6 +17,8 @@ limitations under the License.
 package metrics
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	discovery "k8s.io/api/discovery/v1"
@@ -57,6 +59,39 @@ func TestNumEndpointsAndSlices(t *testing.T) {
 	expectNumEndpointsAndSlices(t, c, 4, 4, 160)
 }
 
+// TestCacheConcurrentUpdates exercises concurrent updates and deletes of the
+// shared cache. It is primarily intended to be run with -race.
+func TestCacheConcurrentUpdates(t *testing.T) {
+	c := NewCache(int32(100))
+
+	p80 := int32(80)
+	pmKey80 := endpointsliceutil.NewPortMapKey([]discovery.EndpointPort{{Port: &p80}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		endpointsNN := types.NamespacedName{Namespace: "ns1", Name: fmt.Sprintf("svc-%d", i)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				spCache := NewEndpointPortCache()
+				spCache.Set(pmKey80, EfficiencyInfo{Endpoints: j, Slices: 1})
+				c.UpdateEndpointPortCache(endpointsNN, spCache)
+			}
+			c.DeleteEndpoints(endpointsNN)
+		}()
+	}
+	wg.Wait()
+
+	// Every Endpoints resource was deleted, so the cache must drain to zero.
+	if c.numEndpoints != 0 {
+		t.Errorf("Expected numEndpoints to be 0, got %d", c.numEndpoints)
+	}
+	if len(c.cache) != 0 {
+		t.Errorf("Expected cache to be empty, got %d entries", len(c.cache))
+	}
+}
+
 func expectNumEndpointsAndSlices(t *testing.T, c *Cache, desired int, actual int, numEndpoints int) {
 	t.Helper()
 	mUpdate := c.desiredAndActualSlices()
@@ -129,6 +129,198 @@ var (
 		},
 		[]string{"operation"},
 	)
+	// SlicesUnchanged tracks the number of times an existing EndpointSlice
+	// already matched the desired state, making the reconcile a no-op.
+	SlicesUnchanged = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "slices_unchanged",
+			Help:           "Number of times an existing EndpointSlice already matched the desired state",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// ApiCallsPerSync tracks the number of API calls made to create, update,
+	// or delete EndpointSlices on each Endpoints sync.
+	ApiCallsPerSync = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "api_calls_per_sync",
+			Help:           "Number of EndpointSlice API calls on each Endpoints sync",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(2, 2, 15),
+		},
+		[]string{},
+	)
+	// AddressesInMultiplePortMaps tracks the number of times an address was
+	// observed in more than one port mapping for the same Endpoints resource.
+	AddressesInMultiplePortMaps = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "addresses_in_multiple_port_maps",
+			Help:           "Number of times an address was observed in multiple port mappings for the same Endpoints resource",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// CrossFamilyAddresses tracks the number of times an IPv4 address was
+	// observed in both its plain and IPv4-mapped IPv6 form in the same
+	// Endpoints resource.
+	CrossFamilyAddresses = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "cross_family_addresses",
+			Help:           "Number of times an IPv4 address was observed in both its plain and IPv4-mapped IPv6 form in the same Endpoints resource",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// HashMismatches tracks the number of times a stored EndpointSlice content
+	// hash disagreed with a recomputation of unchanged content. This is a
+	// correctness canary for the content hashing; it should always be zero.
+	HashMismatches = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "hash_mismatches",
+			Help:           "Number of times a stored EndpointSlice content hash disagreed with a recomputation of unchanged content",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// SlicesRecycled tracks the number of times a would-be create/delete pair
+	// of EndpointSlices was converted into a single update instead.
+	SlicesRecycled = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "slices_recycled",
+			Help:           "Number of EndpointSlice create/delete pairs converted into updates",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// ReconcileErrors tracks EndpointSlice write failures by coarse error
+	// class, so retryable conflicts can be told apart from persistent
+	// failures like forbidden or too-large writes.
+	ReconcileErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "reconcile_errors",
+			Help:           "Number of EndpointSlice write failures, by error class",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"class"},
+	)
+	// InvariantViolations tracks the number of syncs after which the written
+	// slices did not hold exactly the desired endpoints. This is a
+	// correctness canary for the reconcile logic; outside of options that
+	// intentionally defer changes it should always be zero.
+	InvariantViolations = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "invariant_violations",
+			Help:           "Number of syncs after which the written EndpointSlices did not hold exactly the desired endpoints",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// RecycledWithPortChange tracks the number of recycled EndpointSlices
+	// whose update rewrote the slice's port map, changing the fundamental
+	// identity some consumers key on.
+	RecycledWithPortChange = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "recycled_with_port_change",
+			Help:           "Number of recycled EndpointSlices whose update changed the slice's port map",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// DuplicateProtocolPorts tracks Endpoints ports that share a name and
+	// number but differ in protocol. These are mirrored as distinct ports,
+	// but often indicate an unintentionally duplicated port definition.
+	DuplicateProtocolPorts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "duplicate_protocol_ports",
+			Help:           "Number of Endpoints port definitions sharing a name and number but differing in protocol",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{},
+	)
+	// DistinctPortMaps tracks the number of distinct port mappings found on
+	// each Endpoints sync, to surface services with excessive port fan-out.
+	DistinctPortMaps = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "distinct_port_maps",
+			Help:           "Number of distinct port mappings on each Endpoints sync",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(2, 2, 15),
+		},
+		[]string{},
+	)
+	// SliceMatchRatio tracks, on each Endpoints sync, the fraction of port
+	// mappings whose existing slices were matched as-is against those that
+	// had to be regenerated, to surface how often syncs avoid writes.
+	SliceMatchRatio = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "slice_match_ratio",
+			Help:           "Fraction of port mappings whose slices were matched without writes on each Endpoints sync",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.LinearBuckets(0, 0.1, 11),
+		},
+		[]string{},
+	)
+	// SliceSizeBytes tracks the estimated serialized size of each created or
+	// updated EndpointSlice, to catch slices approaching the apiserver object
+	// size limit before writes start failing.
+	SliceSizeBytes = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "slice_size_bytes",
+			Help:           "Estimated serialized size in bytes of each written EndpointSlice",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(256, 2, 14),
+		},
+		[]string{},
+	)
+	// SubsetAddressCount tracks the number of addresses found in each
+	// Endpoints subset processed by a sync, as a distribution across all
+	// synced resources, to surface unusually heavy subsets.
+	SubsetAddressCount = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "subset_address_count",
+			Help:           "Number of addresses in each Endpoints subset processed by a sync",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(1, 2, 13),
+		},
+		[]string{},
+	)
+	// EndpointsPerAddressType tracks the number of desired endpoints of each
+	// address type on each Endpoints sync.
+	EndpointsPerAddressType = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "endpoints_per_address_type",
+			Help:           "Number of desired endpoints of each address type on each Endpoints sync",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(2, 2, 15),
+		},
+		[]string{"address_type"},
+	)
+	// ZoneDistribution tracks the number of desired endpoints in each topology
+	// zone.
+	ZoneDistribution = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      EndpointSliceMirroringSubsystem,
+			Name:           "zone_distribution",
+			Help:           "Number of desired endpoints in each topology zone",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"zone"},
+	)
 )
 
 var registerMetrics sync.Once
@@ -145,5 +337,21 @@ func RegisterMetrics() {
 		legacyregistry.MustRegister(NumEndpointSlices)
 		legacyregistry.MustRegister(DesiredEndpointSlices)
 		legacyregistry.MustRegister(EndpointSliceChanges)
+		legacyregistry.MustRegister(SlicesUnchanged)
+		legacyregistry.MustRegister(ApiCallsPerSync)
+		legacyregistry.MustRegister(AddressesInMultiplePortMaps)
+		legacyregistry.MustRegister(CrossFamilyAddresses)
+		legacyregistry.MustRegister(HashMismatches)
+		legacyregistry.MustRegister(SlicesRecycled)
+		legacyregistry.MustRegister(ReconcileErrors)
+		legacyregistry.MustRegister(InvariantViolations)
+		legacyregistry.MustRegister(RecycledWithPortChange)
+		legacyregistry.MustRegister(DuplicateProtocolPorts)
+		legacyregistry.MustRegister(DistinctPortMaps)
+		legacyregistry.MustRegister(SliceMatchRatio)
+		legacyregistry.MustRegister(SliceSizeBytes)
+		legacyregistry.MustRegister(SubsetAddressCount)
+		legacyregistry.MustRegister(EndpointsPerAddressType)
+		legacyregistry.MustRegister(ZoneDistribution)
 	})
 }
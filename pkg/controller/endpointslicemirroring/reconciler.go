@@ -18,20 +18,116 @@ package endpointslicemirroring
 
 import (
 	"context"
+	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
 
 	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/record"
 	endpointsliceutil "k8s.io/endpointslice/util"
 	"k8s.io/klog/v2"
 	endpointsv1 "k8s.io/kubernetes/pkg/api/v1/endpoints"
 	"k8s.io/kubernetes/pkg/controller/endpointslicemirroring/metrics"
+	netutils "k8s.io/utils/net"
+)
+
+// defaultRequeueDelay is the requeue delay suggested for transient failures
+// when the apiserver did not specify one.
+const defaultRequeueDelay = 5 * time.Second
+
+// requeueError wraps a transient failure with a suggested delay after which
+// the sync should be retried.
+type requeueError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *requeueError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requeueError) Unwrap() error {
+	return e.err
+}
+
+// suggestedRequeueDelay returns the requeue delay suggested for an error
+// returned by reconcile, or false if the error does not carry one.
+func suggestedRequeueDelay(err error) (time.Duration, bool) {
+	var re *requeueError
+	if goerrors.As(err, &re) {
+		return re.after, true
+	}
+	return 0, false
+}
+
+// wrapTransientError wraps an EndpointSlice write failure with a suggested
+// requeue delay when the failure is transient. Rate-limited failures use the
+// delay suggested by the apiserver when one was provided.
+func wrapTransientError(err error) error {
+	if seconds, ok := errors.SuggestsClientDelay(err); ok && seconds > 0 {
+		return &requeueError{err: err, after: time.Duration(seconds) * time.Second}
+	}
+	if errors.IsTooManyRequests(err) || errors.IsConflict(err) {
+		return &requeueError{err: err, after: defaultRequeueDelay}
+	}
+	return err
+}
+
+// requeueForDeferredDeletions returns a requeueError when a sync deferred
+// slice deletions, so the marked slices are deleted on a guaranteed follow-up
+// sync. It returns nil when nothing was deferred.
+func requeueForDeferredDeletions(endpoints *corev1.Endpoints, deferred int) error {
+	if deferred == 0 {
+		return nil
+	}
+	return &requeueError{
+		err:   fmt.Errorf("deferred deletion of %d EndpointSlices for Endpoints %s/%s", deferred, endpoints.Namespace, endpoints.Name),
+		after: defaultRequeueDelay,
+	}
+}
+
+// labelConflictPolicy determines how a conflicting label value on a live
+// EndpointSlice is resolved when the slice is regenerated.
+type labelConflictPolicy string
+
+const (
+	// labelConflictOverwrite replaces a conflicting label value with the value
+	// from the Endpoints resource. This is the default policy.
+	labelConflictOverwrite labelConflictPolicy = "Overwrite"
+	// labelConflictDefer keeps the label value found on the live EndpointSlice.
+	labelConflictDefer labelConflictPolicy = "Defer"
+)
+
+// noTargetRefPolicy determines how addresses without a TargetRef, which may
+// be external backends, are mirrored.
+type noTargetRefPolicy string
+
+const (
+	// noTargetRefMirror mirrors addresses without a TargetRef like any other
+	// address. This is the default policy.
+	noTargetRefMirror noTargetRefPolicy = "Mirror"
+	// noTargetRefSkip leaves addresses without a TargetRef out of the
+	// mirrored slices.
+	noTargetRefSkip noTargetRefPolicy = "Skip"
+	// noTargetRefLabel mirrors addresses without a TargetRef and labels the
+	// generated slices as holding external addresses.
+	noTargetRefLabel noTargetRefPolicy = "Label"
 )
 
 // reconciler is responsible for transforming current EndpointSlice state into
@@ -53,127 +149,1489 @@ type reconciler struct {
 	// for a simple 1:1 mapping between EndpointSubset and EndpointSlice.
 	maxEndpointsPerSubset int32
 
+	// maxReady caps the number of ready addresses mirrored per EndpointSubset.
+	// A value of 0 means only maxEndpointsPerSubset applies.
+	maxReady int32
+
+	// maxNotReady caps the number of not-ready addresses mirrored per
+	// EndpointSubset so a flood of not-ready addresses cannot crowd out ready
+	// ones. A value of 0 means only maxEndpointsPerSubset applies.
+	maxNotReady int32
+
+	// rejectLocalAddresses indicates whether loopback, unspecified, and
+	// multicast addresses should be treated as invalid rather than mirrored.
+	rejectLocalAddresses bool
+
+	// preserveHints indicates whether endpoint Hints set on live slices by
+	// another controller should be carried over to regenerated slices. Hints
+	// are matched by endpoint IP.
+	preserveHints bool
+
+	// labelConflictPolicy determines whether label values that conflict with
+	// a live slice are overwritten or deferred to. An empty value is
+	// equivalent to labelConflictOverwrite.
+	labelConflictPolicy labelConflictPolicy
+
+	// preferredAddressFamily, when set, causes slices created for that
+	// address family to be named so they sort before slices for other
+	// families. Consumers that only read the first slice can then prefer
+	// that family in dual-stack clusters.
+	preferredAddressFamily discovery.AddressType
+
+	// deferSliceDeletion indicates whether EndpointSlices that are no longer
+	// desired should be marked with a pending-delete annotation first and only
+	// deleted on a later reconcile if still undesired, guarding against
+	// transient informer staleness.
+	deferSliceDeletion bool
+
+	// historyLimit, when positive, causes a copy of each live slice to be
+	// retained before an update overwrites it, so a bad rollout can be rolled
+	// back by hand. At most historyLimit copies are kept per Endpoints
+	// resource; the oldest beyond that are pruned.
+	historyLimit int
+
+	// createBeforeDelete indicates that a sync must not leave partially
+	// applied creates behind: when a create fails, the slices already created
+	// by that sync are rolled back before the error is returned. Deletes are
+	// always issued after creates, so a failed create also withholds the
+	// sync's deletes.
+	createBeforeDelete bool
+
+	// portComparator, when set, controls which EndpointPort fields participate
+	// in port map equality when grouping desired endpoints and existing
+	// slices. If nil, all fields participate.
+	portComparator *portComparator
+
+	// failOnIndeterminateAddress indicates whether a reconcile should fail
+	// when the address type of an address cannot be determined. When false,
+	// such addresses are skipped and counted as today.
+	failOnIndeterminateAddress bool
+
+	// detectPortNameConflicts indicates whether named ports that map to
+	// different numbers across subsets should be treated as a
+	// misconfiguration: a warning is recorded and the lowest number wins.
+	// When false, each subset keeps its own numbers as today.
+	detectPortNameConflicts bool
+
+	// contentOnlyUpdates indicates whether updates should be skipped when the
+	// mirrored content of a slice is identical and only mirrored labels or
+	// annotations differ. Such differences are treated as cosmetic and folded
+	// into the next content-changing write.
+	contentOnlyUpdates bool
+
+	// adoptUnmanaged indicates whether existing slices without a managed-by
+	// label should be adopted by this controller, relabeling them on the next
+	// write. When false, such slices are ignored.
+	adoptUnmanaged bool
+
+	// maxChangesPerSync, when set, caps the number of endpoint additions and
+	// removals applied to a live slice in a single sync. The remaining changes
+	// are applied by subsequent reconciles, smoothing large changes out over
+	// time.
+	maxChangesPerSync int
+
+	// earlyFlushSlices indicates whether desired endpoints should be drained
+	// into complete slices as soon as a port mapping accumulates a full
+	// slice's worth during subset iteration, bounding the peak memory held
+	// while mirroring very large Endpoints. When a port mapping already has
+	// existing slices, its drained batches are merged back so matching runs
+	// against the full desired state.
+	earlyFlushSlices bool
+
+	// verifyInvariants indicates whether each sync should recompute the
+	// number of endpoints the written slices hold and count a metric when it
+	// does not equal the desired count, as an opt-in correctness self-check.
+	verifyInvariants bool
+
+	// repackOnQuota indicates whether a create rejected by an
+	// apiserver-enforced slice quota should be recovered from by folding the
+	// endpoints of the rejected and remaining creates into the slices already
+	// written this sync that have spare capacity, instead of failing the
+	// sync.
+	repackOnQuota bool
+
+	// annotateSourceSubsets indicates whether written slices should carry an
+	// annotation mapping each of their endpoints, in order, to the index of
+	// the canonicalized source subset it was mirrored from.
+	annotateSourceSubsets bool
+
+	// maxSubsets, when set, limits mirroring to the first maxSubsets subsets
+	// of each Endpoints resource in their canonicalized order. Remaining
+	// subsets are reported through a Warning event.
+	maxSubsets int32
+
+	// sctpMultihoming indicates whether addresses that share a TargetRef under
+	// an SCTP port mapping should be folded into a single multihomed endpoint
+	// rather than mirrored as separate endpoints. This keeps the addresses of
+	// one SCTP association together so they cannot be split across slices.
+	sctpMultihoming bool
+
+	// noTargetRefPolicy determines how addresses without a TargetRef are
+	// mirrored. An empty value is equivalent to noTargetRefMirror.
+	noTargetRefPolicy noTargetRefPolicy
+
+	// addressTypeResolver, when set, overrides how Endpoints addresses map to
+	// an EndpointSlice AddressType, allowing non-IP identifiers to be
+	// mirrored to custom address types. If nil, addresses resolve to IPv4 or
+	// IPv6 by parsing the IP field.
+	addressTypeResolver addressTypeResolver
+
+	// defaultAddressType, when set, is the AddressType assigned to addresses
+	// whose family cannot be inferred and that no custom resolver maps,
+	// instead of dropping them as indeterminate.
+	defaultAddressType discovery.AddressType
+
+	// podLister is used to look up the Pod backing each desired endpoint so
+	// terminating pods can be identified. If nil, terminating state is not
+	// tracked.
+	podLister corelisters.PodLister
+
+	// maxTerminalPodAge, when positive, causes endpoints whose backing Pod
+	// has been in a terminal phase for longer than this duration to be
+	// dropped as stale instead of mirrored. Requires a PodLister.
+	maxTerminalPodAge time.Duration
+
+	// deprioritizeTerminating indicates that endpoints whose pods are
+	// terminating should be placed in later slices when endpoints are
+	// distributed across multiple slices, so earlier slices prefer serving
+	// endpoints.
+	deprioritizeTerminating bool
+
+	// stablePrimarySlice indicates that, when endpoints are distributed across
+	// multiple slices, the lexicographically-first-named slice should hold a
+	// deterministic subset: the endpoints with the lowest addresses. This
+	// keeps the first slice stable for consumers that only read it.
+	stablePrimarySlice bool
+
+	// notReadyHysteresis is the number of consecutive reconciles a ready to
+	// not-ready transition must be observed before it is written, so an
+	// endpoint flapping between ready and not ready does not generate an
+	// update per flap. A value of 0 disables the hysteresis.
+	notReadyHysteresis int32
+
+	// notReadyObservations tracks, per endpoint, how many consecutive
+	// reconciles have observed the endpoint not ready. Guarded by
+	// notReadyObservationsLock.
+	notReadyObservationsLock sync.Mutex
+	notReadyObservations     map[string]int
+
+	// endpointComparator, when set, overrides how two endpoints that hash
+	// identically are compared when deciding whether a slice needs an update,
+	// so deployments can tune which fields count as a change. If nil,
+	// EndpointsEqualBeyondHash is used.
+	endpointComparator endpointComparator
+
+	// ignoreHints indicates whether endpoint Hints are excluded from endpoint
+	// comparison, so hint writes from another controller do not trigger
+	// updates in clusters not using topology. Applied before any configured
+	// endpointComparator.
+	ignoreHints bool
+
+	// preserveEndpointOrder indicates that endpoints already present in an
+	// updated slice should keep their positions, with new endpoints appended
+	// at the end, rather than the whole slice being reordered on each update.
+	preserveEndpointOrder bool
+
+	// blockOwnerDeletion overrides the BlockOwnerDeletion flag on the owner
+	// reference of generated EndpointSlices. If nil, the default set by
+	// NewControllerRef (true) is kept.
+	blockOwnerDeletion *bool
+
+	// ownerController overrides the Controller flag on the owner reference of
+	// generated EndpointSlices. If nil, the default set by NewControllerRef
+	// (true) is kept.
+	ownerController *bool
+
+	// emitContentGeneration indicates whether generated slices should carry
+	// content hash and generation annotations so external consumers can
+	// cheaply detect real content changes.
+	emitContentGeneration bool
+
+	// stampResourceVersion indicates whether generated slices should carry
+	// the resource version of the Endpoints resource they were mirrored from.
+	// A live slice already carrying the current resource version marks a
+	// replayed sync, whose write is skipped.
+	stampResourceVersion bool
+
+	// annotateContentHash indicates whether generated slices should carry the
+	// content hash annotation without the generation annotation. It is implied
+	// by emitContentGeneration. A stored hash also serves as a fast path when
+	// checking whether a slice already matches the desired state.
+	annotateContentHash bool
+
+	// stampStableIdentifier indicates whether generated slices should carry a
+	// deterministic identifier derived from the Endpoints name, port mapping,
+	// and address type. Unlike the slice UID it survives a delete and
+	// recreate, giving consumers a stable handle on the logical slice.
+	stampStableIdentifier bool
+
+	// markTruncation indicates whether generated slices should be annotated
+	// when the Endpoints resource was truncated, so consumers can tell the
+	// mirrored set is incomplete.
+	markTruncation bool
+
+	// maxShrinkPercent is the largest percentage reduction of a slice's
+	// endpoint count a single sync is expected to produce. Larger reductions
+	// emit a Warning event, as they can indicate an upstream bug, but the
+	// update still proceeds. A value of 0 disables the guardrail.
+	maxShrinkPercent int32
+
+	// syncBudget bounds the wall-clock time a single reconcile may spend
+	// writing EndpointSlices. When exceeded, the reconcile aborts with an
+	// error carrying a requeue hint so the remainder is retried. A value of 0
+	// disables the budget.
+	syncBudget time.Duration
+
+	// emitSummaryEvents indicates whether a single Normal event summarizing
+	// the changes made by each reconcile should be emitted.
+	emitSummaryEvents bool
+
+	// maxEventsPerSync, when set, hard-caps the number of warning events a
+	// single reconcile may emit. Events beyond the budget are dropped and
+	// reported by a single summary event.
+	maxEventsPerSync int
+
+	// debugSlicePlan indicates whether each reconcile should emit a single
+	// Normal event listing the slice actions it computed before applying
+	// them, for live debugging.
+	debugSlicePlan bool
+
+	// onSliceDeleted, when set, is invoked after each successful EndpointSlice
+	// delete so integrations can clean up external state keyed by slice.
+	onSliceDeleted func(namespace, name string)
+
 	// metricsCache tracks values for total numbers of desired endpoints as well
 	// as the efficiency of EndpointSlice endpoints distribution
 	metricsCache *metrics.Cache
+
+	// serviceLister is used to look up the Service corresponding to each
+	// Endpoints resource so mirrored ports can be validated against the ports
+	// declared on the Service. If nil, ports are not validated.
+	serviceLister corelisters.ServiceLister
+
+	// serviceLabelAllowlist lists Service labels that are propagated onto
+	// generated EndpointSlices. If empty, no Service labels are propagated.
+	serviceLabelAllowlist []string
+
+	// endpointSliceLister is used to look up the EndpointSlices of a Service
+	// beyond the mirrored ones, currently to detect slices produced by the
+	// native EndpointSlice controller. If nil, no such detection happens.
+	endpointSliceLister discoverylisters.EndpointSliceLister
+
+	// skipNativelyManaged indicates that Endpoints whose Service already has
+	// EndpointSlices managed by the native EndpointSlice controller should
+	// not be mirrored, since doing so would duplicate every endpoint.
+	// Requires both a ServiceLister and an EndpointSliceLister.
+	skipNativelyManaged bool
+
+	// endpointsLister is used to verify the parent Endpoints resource still
+	// exists before writing slices that reference it as owner. If nil, the
+	// check is skipped.
+	endpointsLister corelisters.EndpointsLister
+
+	// nodeLister is used to look up the topology zone for the node backing
+	// each desired endpoint. If nil, zone distribution metrics are not
+	// populated.
+	nodeLister corelisters.NodeLister
+
+	// splitByZone indicates that endpoints should be partitioned into a
+	// separate slice per topology zone, each labeled with its zone, for
+	// strict zonal isolation. Requires a NodeLister to resolve zones;
+	// endpoints whose zone cannot be determined are grouped together.
+	splitByZone bool
+
+	// sliceStorage performs the EndpointSlice create, update, and delete
+	// operations for finalize. If nil, operations go directly to the API
+	// server via the client.
+	sliceStorage sliceStorage
+
+	// namespaceRateLimiter, when set, throttles slice writes per namespace so
+	// a single noisy namespace cannot starve writes for others.
+	namespaceRateLimiter *namespaceRateLimiter
+
+	// updateBatcher, when set, overrides how the slice updates of a sync are
+	// submitted, allowing multiple updates to be grouped into fewer API calls
+	// where a backend supports it. If nil, one update is issued per slice.
+	updateBatcher updateBatcher
+
+	// desiredCalcFactory, when set, constructs the desiredCalc each sync
+	// computes its desired state with, so alternative desired-state
+	// computations can be plugged in. If nil, newDesiredCalc is used.
+	desiredCalcFactory func() *desiredCalc
+
+	// changelog, when set, accumulates the EndpointSlice writes performed by
+	// each reconcile so callers can audit what changed. It is reset at the
+	// start of each reconcile.
+	changelog *sliceChangelog
 }
 
-// reconcile takes an Endpoints resource and ensures that corresponding
-// EndpointSlices exist. It creates, updates, or deletes EndpointSlices to
-// ensure the desired set of addresses are represented by EndpointSlices.
-func (r *reconciler) reconcile(logger klog.Logger, endpoints *corev1.Endpoints, existingSlices []*discovery.EndpointSlice) error {
-	// Calculate desired state.
-	d := newDesiredCalc()
+// effectiveConfiguration returns the reconciler options that shape mirroring
+// behavior, so they can be logged at startup and misconfiguration spotted
+// from the controller log.
+func (r *reconciler) effectiveConfiguration() map[string]interface{} {
+	return map[string]interface{}{
+		"managedBy":             controllerName,
+		"maxEndpointsPerSubset": r.maxEndpointsPerSubset,
+		"maxSubsets":            r.maxSubsets,
+		"maxChangesPerSync":     r.maxChangesPerSync,
+		"maxEventsPerSync":      r.maxEventsPerSync,
+		"adoptUnmanaged":        r.adoptUnmanaged,
+		"contentOnlyUpdates":    r.contentOnlyUpdates,
+		"deferSliceDeletion":    r.deferSliceDeletion,
+		"earlyFlushSlices":      r.earlyFlushSlices,
+		"ignoreHints":           r.ignoreHints,
+		"repackOnQuota":         r.repackOnQuota,
+		"verifyInvariants":      r.verifyInvariants,
+	}
+}
+
+// logEffectiveConfiguration logs the reconciler's effective configuration
+// with deterministically ordered keys.
+func (r *reconciler) logEffectiveConfiguration(logger klog.Logger) {
+	config := r.effectiveConfiguration()
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kvs := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		kvs = append(kvs, key, config[key])
+	}
+	logger.Info("Effective EndpointSliceMirroring reconciler configuration", kvs...)
+}
+
+// endpointComparator reports whether two endpoints that hash identically are
+// equal for reconciliation purposes.
+type endpointComparator func(a, b *discovery.Endpoint) bool
+
+// endpointsEqual compares two endpoints that hash identically, delegating to
+// the configured comparator when one is set.
+func (r *reconciler) endpointsEqual(a, b *discovery.Endpoint) bool {
+	if r.ignoreHints && (a.Hints != nil || b.Hints != nil) {
+		aCopy := a.DeepCopy()
+		aCopy.Hints = nil
+		bCopy := b.DeepCopy()
+		bCopy.Hints = nil
+		a, b = aCopy, bCopy
+	}
+	if r.endpointComparator != nil {
+		return r.endpointComparator(a, b)
+	}
+	return endpointsliceutil.EndpointsEqualBeyondHash(a, b)
+}
+
+// eventBudget counts the warning events emitted by a single reconcile so
+// their volume can be hard-capped.
+type eventBudget struct {
+	limit   int
+	emitted int
+	dropped int
+}
+
+// event emits a warning event for an Endpoints resource, counting it against
+// the reconcile's event budget. Events beyond the budget are dropped and
+// reported by flushEventBudget when the reconcile finishes.
+func (r *reconciler) event(budget *eventBudget, endpoints *corev1.Endpoints, eventtype, reason, messageFmt string, args ...interface{}) {
+	if budget.limit > 0 {
+		if budget.emitted >= budget.limit {
+			budget.dropped++
+			return
+		}
+		budget.emitted++
+	}
+	r.eventRecorder.Eventf(endpoints, eventtype, reason, messageFmt, args...)
+}
+
+// flushEventBudget emits a single summary event if the reconcile dropped any
+// events beyond its budget.
+func (r *reconciler) flushEventBudget(budget *eventBudget, endpoints *corev1.Endpoints) {
+	if budget.dropped == 0 {
+		return
+	}
+	r.eventRecorder.Eventf(endpoints, corev1.EventTypeWarning, EventBudgetExceeded,
+		"Suppressed %d events beyond the budget of %d for this sync", budget.dropped, budget.limit)
+}
+
+// sliceChange records a single EndpointSlice write performed by finalize:
+// the slice name, the action taken, and the number of endpoints written (or
+// removed, for deletes).
+type sliceChange struct {
+	Slice     string
+	Action    string
+	Endpoints int
+}
+
+// sliceChangelog accumulates the EndpointSlice writes performed by reconcile
+// for audit purposes.
+type sliceChangelog struct {
+	mu      sync.Mutex
+	changes []sliceChange
+}
+
+func (c *sliceChangelog) record(action, slice string, endpoints int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changes = append(c.changes, sliceChange{Slice: slice, Action: action, Endpoints: endpoints})
+}
+
+func (c *sliceChangelog) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changes = nil
+}
+
+// Changes returns a copy of the recorded changes.
+func (c *sliceChangelog) Changes() []sliceChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changes := make([]sliceChange, len(c.changes))
+	copy(changes, c.changes)
+	return changes
+}
+
+// sliceStorage abstracts the EndpointSlice write operations performed by
+// finalize so tests can substitute an implementation that enforces
+// apiserver-like constraints without a real apiserver.
+type sliceStorage interface {
+	Create(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error)
+	Update(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error)
+	Delete(ctx context.Context, namespace, name string) error
+}
+
+// clientSliceStorage implements sliceStorage directly on top of a clientset.
+type clientSliceStorage struct {
+	client clientset.Interface
+}
+
+func (c *clientSliceStorage) Create(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	return c.client.DiscoveryV1().EndpointSlices(namespace).Create(ctx, endpointSlice, metav1.CreateOptions{})
+}
+
+func (c *clientSliceStorage) Update(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	return c.client.DiscoveryV1().EndpointSlices(namespace).Update(ctx, endpointSlice, metav1.UpdateOptions{})
+}
+
+func (c *clientSliceStorage) Delete(ctx context.Context, namespace, name string) error {
+	return c.client.DiscoveryV1().EndpointSlices(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// updateBatcher abstracts how the slice updates of a single sync are
+// submitted, so multiple updates can be grouped into fewer API calls once a
+// backend supports aggregated writes. It returns the slices as written, the
+// number of API calls made including failed ones, and the first error hit.
+type updateBatcher interface {
+	update(ctx context.Context, storage sliceStorage, namespace string, slices []*discovery.EndpointSlice) ([]*discovery.EndpointSlice, int, error)
+}
+
+// perObjectBatcher is the default updateBatcher, issuing one API call per
+// slice.
+type perObjectBatcher struct{}
+
+func (perObjectBatcher) update(ctx context.Context, storage sliceStorage, namespace string, slices []*discovery.EndpointSlice) ([]*discovery.EndpointSlice, int, error) {
+	updated := make([]*discovery.EndpointSlice, 0, len(slices))
+	calls := 0
+	for _, endpointSlice := range slices {
+		if err := budgetExceeded(ctx); err != nil {
+			return updated, calls, err
+		}
+		calls++
+		updatedSlice, err := storage.Update(ctx, namespace, endpointSlice)
+		if err != nil {
+			return updated, calls, fmt.Errorf("failed to update %s EndpointSlice: %w", endpointSlice.Name, err)
+		}
+		updated = append(updated, updatedSlice)
+	}
+	return updated, calls, nil
+}
+
+// namespaceRateLimiter throttles slice writes per namespace so a single noisy
+// namespace cannot starve writes for others.
+type namespaceRateLimiter struct {
+	qps   rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// newNamespaceRateLimiter returns a namespaceRateLimiter allowing qps slice
+// writes per namespace with the given burst.
+func newNamespaceRateLimiter(qps float64, burst int) *namespaceRateLimiter {
+	return &namespaceRateLimiter{
+		qps:      rate.Limit(qps),
+		burst:    burst,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// wait blocks until the namespace's limiter permits another write or the
+// context is done.
+func (n *namespaceRateLimiter) wait(ctx context.Context, namespace string) error {
+	n.mu.Lock()
+	limiter, ok := n.limiters[namespace]
+	if !ok {
+		limiter = rate.NewLimiter(n.qps, n.burst)
+		n.limiters[namespace] = limiter
+	}
+	n.mu.Unlock()
+	return limiter.Wait(ctx)
+}
+
+// rateLimitedSliceStorage wraps a sliceStorage with a per-namespace rate
+// limiter.
+type rateLimitedSliceStorage struct {
+	delegate sliceStorage
+	limiter  *namespaceRateLimiter
+}
+
+func (s *rateLimitedSliceStorage) Create(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	if err := s.limiter.wait(ctx, namespace); err != nil {
+		return nil, err
+	}
+	return s.delegate.Create(ctx, namespace, endpointSlice)
+}
+
+func (s *rateLimitedSliceStorage) Update(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	if err := s.limiter.wait(ctx, namespace); err != nil {
+		return nil, err
+	}
+	return s.delegate.Update(ctx, namespace, endpointSlice)
+}
+
+func (s *rateLimitedSliceStorage) Delete(ctx context.Context, namespace, name string) error {
+	if err := s.limiter.wait(ctx, namespace); err != nil {
+		return err
+	}
+	return s.delegate.Delete(ctx, namespace, name)
+}
+
+// storage returns the sliceStorage finalize should write through.
+func (r *reconciler) storage() sliceStorage {
+	storage := r.sliceStorage
+	if storage == nil {
+		storage = &clientSliceStorage{client: r.client}
+	}
+	if r.namespaceRateLimiter != nil {
+		storage = &rateLimitedSliceStorage{delegate: storage, limiter: r.namespaceRateLimiter}
+	}
+	return storage
+}
+
+// batcher returns the updateBatcher finalize should submit updates through.
+func (r *reconciler) batcher() updateBatcher {
+	if r.updateBatcher != nil {
+		return r.updateBatcher
+	}
+	return perObjectBatcher{}
+}
+
+// desiredState calculates the desired endpoint state for an Endpoints
+// resource, returning the calculated state, the canonicalized subsets it was
+// derived from, and the numbers of invalid and skipped addresses encountered.
+func (r *reconciler) desiredState(logger klog.Logger, endpoints *corev1.Endpoints) (*desiredCalc, []corev1.EndpointSubset, int, int) {
+	var d *desiredCalc
+	if r.desiredCalcFactory != nil {
+		d = r.desiredCalcFactory()
+	} else {
+		d = newDesiredCalc()
+	}
+	d.addressTypeResolver = r.addressTypeResolver
+	d.defaultAddressType = r.defaultAddressType
+	if r.annotateSourceSubsets {
+		d.sourceSubsetByAddress = map[string]int{}
+	}
+	d.noTargetRefPolicy = r.noTargetRefPolicy
+	d.portComparator = r.portComparator
+	d.groupSCTPMultihomed = r.sctpMultihoming
+	if r.earlyFlushSlices {
+		d.flushThreshold = int(r.maxEndpointsPerSubset)
+	}
 
 	numInvalidAddresses := 0
 	addressesSkipped := 0
 
 	// canonicalize the Endpoints subsets before processing them
 	subsets := endpointsv1.RepackSubsets(endpoints.Subsets)
-	for _, subset := range subsets {
-		multiKey := d.initPorts(subset.Ports)
 
-		totalAddresses := len(subset.Addresses) + len(subset.NotReadyAddresses)
-		totalAddressesAdded := 0
+	// Detect named ports that map to different numbers across subsets; the
+	// lowest number wins and initPorts rewrites the others to it.
+	if r.detectPortNameConflicts {
+		d.resolvePortNameConflicts(subsets)
+	}
 
-		for _, address := range subset.Addresses {
-			// Break if we've reached the max number of addresses to mirror
-			// per EndpointSubset. This allows for a simple 1:1 mapping between
-			// EndpointSubset and EndpointSlice.
-			if totalAddressesAdded >= int(r.maxEndpointsPerSubset) {
-				break
-			}
-			if ok := d.addAddress(address, multiKey, true); ok {
-				totalAddressesAdded++
-			} else {
-				numInvalidAddresses++
-				logger.Info("Address in Endpoints is not a valid IP, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints), "IP", address.IP)
-			}
+	// Ports sharing a name and number but differing in protocol are valid and
+	// mirrored as distinct ports; report them as they are often unintended.
+	r.reportDuplicateProtocolPorts(logger, endpoints, subsets)
+
+	for subsetIndex, subset := range subsets {
+		// Subsets beyond maxSubsets are not mirrored. The canonicalized order
+		// makes the retained prefix deterministic.
+		if r.maxSubsets > 0 && subsetIndex >= int(r.maxSubsets) {
+			break
 		}
+		d.currentSubsetIndex = subsetIndex
+		// Record the subset size so heavy subsets can be identified.
+		metrics.SubsetAddressCount.WithLabelValues().Observe(float64(len(subset.Addresses) + len(subset.NotReadyAddresses)))
 
-		for _, address := range subset.NotReadyAddresses {
-			// Break if we've reached the max number of addresses to mirror
-			// per EndpointSubset. This allows for a simple 1:1 mapping between
-			// EndpointSubset and EndpointSlice.
-			if totalAddressesAdded >= int(r.maxEndpointsPerSubset) {
-				break
+		// A single EndpointSlice cannot hold more than maxPortsPerSlice
+		// ports, so subsets with more distinct ports are split across slices
+		// by port.
+		for _, subsetPorts := range splitPortsBySliceLimit(subset.Ports) {
+			multiKey := d.initPorts(subsetPorts)
+
+			totalAddresses := len(subset.Addresses) + len(subset.NotReadyAddresses)
+			totalAddressesAdded := 0
+			readyAdded := 0
+			notReadyAdded := 0
+
+			for _, address := range subset.Addresses {
+				// Break if we've reached the max number of addresses to mirror
+				// per EndpointSubset. This allows for a simple 1:1 mapping between
+				// EndpointSubset and EndpointSlice.
+				if totalAddressesAdded >= int(r.maxEndpointsPerSubset) {
+					break
+				}
+				// Break if we've reached the separate cap for ready addresses.
+				if r.maxReady > 0 && readyAdded >= int(r.maxReady) {
+					break
+				}
+				// An empty IP is reported separately from an unparseable one so
+				// the generic invalid-IP message does not obscure the cause.
+				if address.IP == "" {
+					d.numEmptyAddresses++
+					numInvalidAddresses++
+					logger.Info("Address in Endpoints has an empty IP, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints))
+					continue
+				}
+				if r.rejectLocalAddresses && isLocalAddress(address.IP) {
+					numInvalidAddresses++
+					logger.Info("Address in Endpoints is a loopback, unspecified, or multicast address, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints), "IP", address.IP)
+					continue
+				}
+				if ok := d.addAddress(address, multiKey, true); ok {
+					totalAddressesAdded++
+					readyAdded++
+				} else {
+					numInvalidAddresses++
+					logger.Info("Address in Endpoints is not a valid IP, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints), "IP", address.IP)
+				}
 			}
-			if ok := d.addAddress(address, multiKey, false); ok {
-				totalAddressesAdded++
-			} else {
-				numInvalidAddresses++
-				logger.Info("Address in Endpoints is not a valid IP, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints), "IP", address.IP)
+
+			for _, address := range subset.NotReadyAddresses {
+				// Break if we've reached the max number of addresses to mirror
+				// per EndpointSubset. This allows for a simple 1:1 mapping between
+				// EndpointSubset and EndpointSlice.
+				if totalAddressesAdded >= int(r.maxEndpointsPerSubset) {
+					break
+				}
+				// Break if we've reached the separate cap for not-ready addresses.
+				if r.maxNotReady > 0 && notReadyAdded >= int(r.maxNotReady) {
+					break
+				}
+				// An empty IP is reported separately from an unparseable one so
+				// the generic invalid-IP message does not obscure the cause.
+				if address.IP == "" {
+					d.numEmptyAddresses++
+					numInvalidAddresses++
+					logger.Info("Address in Endpoints has an empty IP, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints))
+					continue
+				}
+				if r.rejectLocalAddresses && isLocalAddress(address.IP) {
+					numInvalidAddresses++
+					logger.Info("Address in Endpoints is a loopback, unspecified, or multicast address, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints), "IP", address.IP)
+					continue
+				}
+				if ok := d.addAddress(address, multiKey, false); ok {
+					totalAddressesAdded++
+					notReadyAdded++
+				} else {
+					numInvalidAddresses++
+					logger.Info("Address in Endpoints is not a valid IP, it will not be mirrored to an EndpointSlice", "endpoints", klog.KObj(endpoints), "IP", address.IP)
+				}
 			}
+
+			addressesSkipped += totalAddresses - totalAddressesAdded
 		}
+	}
 
-		addressesSkipped += totalAddresses - totalAddressesAdded
+	return d, subsets, numInvalidAddresses, addressesSkipped
+}
+
+// desiredStateJSON returns the desired endpoint state computed for an
+// Endpoints resource serialized to JSON, keyed by address type and port
+// mapping. It does not read or write any EndpointSlices and is intended for
+// debugging what the controller would mirror.
+func (r *reconciler) desiredStateJSON(logger klog.Logger, endpoints *corev1.Endpoints) ([]byte, error) {
+	d, _, _, _ := r.desiredState(logger, endpoints)
+
+	desired := map[string][]discovery.Endpoint{}
+	for portKey, endpointSet := range d.endpointsByKey {
+		// initPorts registers a key for every address type, so skip address
+		// types with no desired endpoints.
+		if endpointSet.Len() == 0 {
+			continue
+		}
+		desiredEndpoints := []discovery.Endpoint{}
+		for _, endpoint := range endpointSet.UnsortedList() {
+			desiredEndpoints = append(desiredEndpoints, *endpoint)
+		}
+		// UnsortedList order is not deterministic, so sort by first address to
+		// keep the output stable.
+		sort.Slice(desiredEndpoints, func(i, j int) bool {
+			return desiredEndpoints[i].Addresses[0] < desiredEndpoints[j].Addresses[0]
+		})
+		desired[string(portKey)] = desiredEndpoints
 	}
 
+	return json.MarshalIndent(desired, "", "  ")
+}
+
+// reconcile takes an Endpoints resource and ensures that corresponding
+// EndpointSlices exist. It creates, updates, or deletes EndpointSlices to
+// ensure the desired set of addresses are represented by EndpointSlices.
+func (r *reconciler) reconcile(logger klog.Logger, endpoints *corev1.Endpoints, existingSlices []*discovery.EndpointSlice) error {
+	// Endpoints delivered through informers always carry a name and
+	// namespace, but a malformed object from a stale cache or a direct call
+	// would produce slices with a broken owner reference that could never be
+	// cleaned up. Reject it before computing any state.
+	if endpoints.Name == "" || endpoints.Namespace == "" {
+		return fmt.Errorf("endpoints name and namespace must not be empty, got %q/%q", endpoints.Namespace, endpoints.Name)
+	}
+
+	// When enabled, Endpoints whose Service is already reconciled by the
+	// native EndpointSlice controller are not mirrored, since mirroring them
+	// would duplicate every endpoint. Slices mirrored earlier are cleaned up.
+	if r.skipNativelyManaged && r.hasNativeSlices(endpoints) {
+		logger.V(2).Info("Service already has EndpointSlices managed by the EndpointSlice controller, skipping mirroring", "endpoints", klog.KObj(endpoints))
+		deferredDeletions, err := r.finalize(context.TODO(), endpoints, slicesByAction{toDelete: existingSlices})
+		if err != nil {
+			return err
+		}
+		return requeueForDeferredDeletions(endpoints, deferredDeletions)
+	}
+
+	if r.changelog != nil {
+		r.changelog.reset()
+	}
+
+	// Hard-cap the number of warning events this reconcile may emit. Dropped
+	// events are reported by a single summary event once the sync finishes.
+	budget := &eventBudget{limit: r.maxEventsPerSync}
+	defer r.flushEventBudget(budget, endpoints)
+
+	d, subsets, numInvalidAddresses, addressesSkipped := r.desiredState(logger, endpoints)
+
 	// This metric includes addresses skipped for being invalid or exceeding
 	// MaxEndpointsPerSubset.
 	metrics.AddressesSkippedPerSync.WithLabelValues().Observe(float64(addressesSkipped))
 
+	// Record the port mapping fan-out. Only port mappings with desired
+	// endpoints count, since a key is registered for every address type.
+	numPortMaps := 0
+	for key, endpointSet := range d.endpointsByKey {
+		if endpointSet.Len() > 0 || len(d.flushedByKey[key]) > 0 {
+			numPortMaps++
+		}
+	}
+	metrics.DistinctPortMaps.WithLabelValues().Observe(float64(numPortMaps))
+
+	// Record the number of desired endpoints of each address type, summed
+	// across port mappings.
+	endpointsByAddrType := map[discovery.AddressType]int{}
+	for key, endpointSet := range d.endpointsByKey {
+		if endpointSet.Len() > 0 {
+			endpointsByAddrType[key.addressType()] += endpointSet.Len()
+		}
+	}
+	for key, batches := range d.flushedByKey {
+		for _, batch := range batches {
+			endpointsByAddrType[key.addressType()] += len(batch)
+		}
+	}
+	for addrType, numEndpoints := range endpointsByAddrType {
+		metrics.EndpointsPerAddressType.WithLabelValues(string(addrType)).Observe(float64(numEndpoints))
+	}
+
 	// Record an event on the Endpoints resource if we skipped mirroring for any
-	// invalid IP addresses.
-	if numInvalidAddresses > 0 {
-		r.eventRecorder.Eventf(endpoints, corev1.EventTypeWarning, InvalidIPAddress,
-			"Skipped %d invalid IP addresses when mirroring to EndpointSlices", numInvalidAddresses)
+	// invalid IP addresses. Addresses with an empty IP are reported separately.
+	if numInvalidAddresses > d.numEmptyAddresses {
+		r.event(budget, endpoints, corev1.EventTypeWarning, InvalidIPAddress,
+			"Skipped %d invalid IP addresses when mirroring to EndpointSlices", numInvalidAddresses-d.numEmptyAddresses)
+	}
+	if d.numEmptyAddresses > 0 {
+		r.event(budget, endpoints, corev1.EventTypeWarning, EmptyIPAddress,
+			"Skipped %d addresses with an empty IP when mirroring to EndpointSlices", d.numEmptyAddresses)
+	}
+
+	// Record an event for each named port that mapped to conflicting numbers
+	// across subsets.
+	if len(d.portNameConflicts) > 0 {
+		conflictingNames := make([]string, 0, len(d.portNameConflicts))
+		for name := range d.portNameConflicts {
+			conflictingNames = append(conflictingNames, name)
+		}
+		sort.Strings(conflictingNames)
+		for _, name := range conflictingNames {
+			logger.Info("Port name maps to conflicting numbers across Endpoints subsets", "endpoints", klog.KObj(endpoints), "portName", name, "port", d.portNumberByName[name], "ignoredPorts", d.portNameConflicts[name])
+			r.event(budget, endpoints, corev1.EventTypeWarning, PortNameConflict,
+				"Port name %q maps to conflicting numbers across subsets; using %d, ignoring %v", name, d.portNumberByName[name], d.portNameConflicts[name])
+		}
+	}
+
+	// Record an event if subsets beyond the configured maximum were dropped.
+	if r.maxSubsets > 0 && len(subsets) > int(r.maxSubsets) {
+		logger.Info("Endpoints has more subsets than the configured maximum, the remainder will not be mirrored", "endpoints", klog.KObj(endpoints), "subsets", len(subsets), "maxSubsets", r.maxSubsets)
+		r.event(budget, endpoints, corev1.EventTypeWarning, TooManySubsets,
+			"Only the first %d of %d subsets were mirrored to EndpointSlices", r.maxSubsets, len(subsets))
 	}
 
 	// Record a separate event if we skipped mirroring due to the number of
 	// addresses exceeding MaxEndpointsPerSubset.
 	if addressesSkipped > numInvalidAddresses {
 		logger.Info("Addresses in Endpoints were skipped due to exceeding MaxEndpointsPerSubset", "skippedAddresses", addressesSkipped, "endpoints", klog.KObj(endpoints))
-		r.eventRecorder.Eventf(endpoints, corev1.EventTypeWarning, TooManyAddressesToMirror,
+		r.event(budget, endpoints, corev1.EventTypeWarning, TooManyAddressesToMirror,
 			"A max of %d addresses can be mirrored to EndpointSlices per Endpoints subset. %d addresses were skipped", r.maxEndpointsPerSubset, addressesSkipped)
 	}
 
-	// Build data structures for existing state.
-	existingSlicesByKey := endpointSlicesByKey(existingSlices)
+	// When configured, an address whose type could not be determined fails the
+	// whole reconcile instead of being silently skipped, leaving the existing
+	// slices untouched until the Endpoints resource is corrected.
+	if r.failOnIndeterminateAddress && d.numIndeterminateAddresses > 0 {
+		return fmt.Errorf("failed to determine the address type for %d addresses in Endpoints %s/%s", d.numIndeterminateAddresses, endpoints.Namespace, endpoints.Name)
+	}
+
+	r.validatePortsAgainstService(logger, budget, endpoints, subsets)
+	r.markTerminatingEndpoints(logger, d)
+	r.dropStaleTerminalEndpoints(logger, d)
+	deferredTransitions := r.applyNotReadyHysteresis(logger, endpoints, d, existingSlices)
+	r.recordZoneDistribution(logger, endpoints, d)
+	observeCrossPortMapAddresses(logger, endpoints, d)
+	observeCrossFamilyAddresses(logger, endpoints, subsets)
+
+	// Build data structures for existing state. Slices whose owner reference
+	// points at a different Endpoints UID belong to a previous incarnation of
+	// this Endpoints with the same name; leave them to the garbage collection
+	// or adoption path rather than deleting or updating them here.
+	ownedSlices := make([]*discovery.EndpointSlice, 0, len(existingSlices))
+	for _, existingSlice := range existingSlices {
+		if ownedByDifferentEndpointsUID(endpoints, existingSlice) {
+			logger.V(2).Info("Ignoring EndpointSlice owned by a different Endpoints UID", "endpointSlice", klog.KObj(existingSlice), "endpoints", klog.KObj(endpoints))
+			continue
+		}
+		// Legacy slices without a managed-by label are adopted, taking
+		// ownership by relabeling them on the next write, or ignored entirely.
+		if existingSlice.Labels[discovery.LabelManagedBy] == "" && !r.adoptUnmanaged {
+			logger.V(2).Info("Ignoring EndpointSlice without a managed-by label", "endpointSlice", klog.KObj(existingSlice), "endpoints", klog.KObj(endpoints))
+			continue
+		}
+		ownedSlices = append(ownedSlices, existingSlice)
+	}
+	existingSlicesByKey := endpointSlicesByKey(ownedSlices, r.portComparator)
+
+	// An endpoint whose IP changed family between syncs moves between
+	// address types: the desired state is recomputed from scratch, so the old
+	// family's entry is removed and the new family's added. Log the migration
+	// so the slice churn can be attributed.
+	observeFamilyMigrations(logger, endpoints, d, ownedSlices)
 
 	// Determine changes necessary for each group of slices by port map.
 	epMetrics := metrics.NewEndpointPortCache()
 	totals := totalsByAction{}
 	slices := slicesByAction{}
 
+	// Track, per port mapping, whether the existing slices were matched as-is
+	// or had to be regenerated.
+	matchedKeys := 0
+	regeneratedKeys := 0
+
+	// Batches drained by early flushing become complete slices directly when
+	// their port mapping has no existing slices. Otherwise they are merged
+	// back into the live set so existing slices are matched against the full
+	// desired state.
+	for portKey, batches := range d.flushedByKey {
+		if len(existingSlicesByKey[portKey]) > 0 {
+			for _, batch := range batches {
+				for _, endpoint := range batch {
+					d.endpointsByKey[portKey].Insert(endpoint)
+				}
+			}
+			continue
+		}
+		for _, batch := range batches {
+			batchSet := endpointsliceutil.EndpointSet{}
+			for _, endpoint := range batch {
+				batchSet.Insert(endpoint)
+			}
+			pmSlices, pmTotals := r.reconcileByPortMapping(
+				logger, budget, endpoints, nil, batchSet, d.portsByKey[portKey], portKey.addressType())
+			slices.append(pmSlices)
+			totals.add(pmTotals)
+			regeneratedKeys++
+		}
+	}
+
 	for portKey, desiredEndpoints := range d.endpointsByKey {
 		numEndpoints := len(desiredEndpoints)
 		pmSlices, pmTotals := r.reconcileByPortMapping(
-			endpoints, existingSlicesByKey[portKey], desiredEndpoints, d.portsByKey[portKey], portKey.addressType())
+			logger, budget, endpoints, existingSlicesByKey[portKey], desiredEndpoints, d.portsByKey[portKey], portKey.addressType())
 
 		slices.append(pmSlices)
 		totals.add(pmTotals)
 
+		// A port mapping whose plan holds no actions was matched as-is;
+		// mappings registered for both families but holding nothing are
+		// neither.
+		if numEndpoints > 0 || len(existingSlicesByKey[portKey]) > 0 {
+			if len(pmSlices.toCreate)+len(pmSlices.toUpdate)+len(pmSlices.toDelete) == 0 {
+				matchedKeys++
+			} else {
+				regeneratedKeys++
+			}
+		}
+
 		epMetrics.Set(endpointsliceutil.PortMapKey(portKey), metrics.EfficiencyInfo{
 			Endpoints: numEndpoints,
 			Slices:    len(existingSlicesByKey[portKey]) + len(pmSlices.toCreate) - len(pmSlices.toDelete),
 		})
 	}
 
-	// If there are unique sets of ports that are no longer desired, mark
-	// the corresponding endpoint slices for deletion.
-	for portKey, existingSlices := range existingSlicesByKey {
-		if _, ok := d.endpointsByKey[portKey]; !ok {
-			for _, existingSlice := range existingSlices {
-				slices.toDelete = append(slices.toDelete, existingSlice)
+	// Record how much of this sync was satisfied by existing slices. A ratio
+	// persistently below 1 on a quiet cluster suggests something is churning
+	// the mirrored content.
+	if total := matchedKeys + regeneratedKeys; total > 0 {
+		metrics.SliceMatchRatio.WithLabelValues().Observe(float64(matchedKeys) / float64(total))
+	}
+
+	// If there are unique sets of ports that are no longer desired, mark
+	// the corresponding endpoint slices for deletion.
+	for portKey, existingSlices := range existingSlicesByKey {
+		if _, ok := d.endpointsByKey[portKey]; !ok {
+			for _, existingSlice := range existingSlices {
+				slices.toDelete = append(slices.toDelete, existingSlice)
+			}
+		}
+	}
+
+	metrics.EndpointsAddedPerSync.WithLabelValues().Observe(float64(totals.added))
+	metrics.EndpointsUpdatedPerSync.WithLabelValues().Observe(float64(totals.updated))
+	metrics.EndpointsRemovedPerSync.WithLabelValues().Observe(float64(totals.removed))
+
+	// Label generated slices holding addresses without a TargetRef so
+	// consumers can identify slices with external backends.
+	if r.noTargetRefPolicy == noTargetRefLabel && d.hasExternalAddresses {
+		for _, epSlice := range slices.toCreate {
+			epSlice.Labels[externalAddressesLabel] = "true"
+		}
+		for _, epSlice := range slices.toUpdate {
+			epSlice.Labels[externalAddressesLabel] = "true"
+		}
+	}
+
+	// Mark generated slices as part of a truncated set so consumers can tell
+	// the mirror is incomplete.
+	if r.markTruncation && addressesSkipped > numInvalidAddresses {
+		for _, epSlice := range slices.toCreate {
+			markSliceTruncated(epSlice)
+		}
+		for _, epSlice := range slices.toUpdate {
+			markSliceTruncated(epSlice)
+		}
+	}
+
+	// Stamp each written slice with the source subset of its endpoints so
+	// consumers can trace mirrored endpoints back to the Endpoints resource.
+	if r.annotateSourceSubsets {
+		annotateSourceSubsets(d, slices)
+	}
+
+	// The parent Endpoints may have been deleted between enqueue and
+	// reconcile. Creating slices that reference it as owner would fail, so
+	// clean up the existing mirrored slices instead.
+	if r.endpointsLister != nil {
+		if _, err := r.endpointsLister.Endpoints(endpoints.Namespace).Get(endpoints.Name); err != nil && errors.IsNotFound(err) {
+			logger.V(2).Info("Endpoints no longer exists, cleaning up mirrored EndpointSlices", "endpoints", klog.KObj(endpoints))
+			deferredDeletions, err := r.finalize(context.TODO(), endpoints, slicesByAction{toDelete: existingSlices})
+			if err != nil {
+				return err
+			}
+			return requeueForDeferredDeletions(endpoints, deferredDeletions)
+		}
+	}
+
+	endpointsNN := types.NamespacedName{Name: endpoints.Name, Namespace: endpoints.Namespace}
+	r.metricsCache.UpdateEndpointPortCache(endpointsNN, epMetrics)
+
+	// Enforce the reconcile time budget through a context deadline so writes
+	// stop promptly once the budget is spent.
+	ctx := context.TODO()
+	if r.syncBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.syncBudget)
+		defer cancel()
+	}
+
+	// Emit the computed plan before applying it so the actions can be
+	// correlated with the writes that follow when debugging live clusters.
+	if r.debugSlicePlan {
+		r.eventRecorder.Eventf(endpoints, corev1.EventTypeNormal, SlicePlan,
+			"Planned EndpointSlice actions: create %v, update %v, delete %v",
+			planSliceNames(slices.toCreate), planSliceNames(slices.toUpdate), planSliceNames(slices.toDelete))
+	}
+
+	// Capture the planned endpoint total before finalize, since generated
+	// slices are returned to the pool once written.
+	plannedTotal := 0
+	if r.verifyInvariants {
+		plannedTotal = plannedEndpointTotal(ownedSlices, slices)
+	}
+
+	deferredDeletions, err := r.finalize(ctx, endpoints, slices)
+	if err != nil {
+		return err
+	}
+
+	// Opt-in post-condition: the slices left behind by a sync should hold
+	// exactly the desired endpoints. Options that intentionally defer changes,
+	// like maxChangesPerSync or deferSliceDeletion, can report transient
+	// violations until the state converges.
+	if r.verifyInvariants && plannedTotal != d.numDesiredEndpoints {
+		logger.Error(nil, "Endpoint count invariant violated after sync", "endpoints", klog.KObj(endpoints), "expected", d.numDesiredEndpoints, "actual", plannedTotal)
+		metrics.InvariantViolations.WithLabelValues().Inc()
+	}
+
+	// Emit a single Normal event summarizing this sync rather than relying on
+	// per-action events.
+	if r.emitSummaryEvents {
+		r.eventRecorder.Eventf(endpoints, corev1.EventTypeNormal, SyncSummary,
+			"Mirrored EndpointSlices: %d created, %d updated, %d deleted, %d addresses truncated",
+			len(slices.toCreate), len(slices.toUpdate), len(slices.toDelete), addressesSkipped-numInvalidAddresses)
+	}
+
+	// A deferred not-ready transition only advances on the next reconcile, and
+	// the suppressed write generates no further events, so requeue the key to
+	// guarantee the transition eventually lands.
+	if deferredTransitions > 0 {
+		return &requeueError{
+			err:   fmt.Errorf("deferred %d not-ready transitions for Endpoints %s/%s", deferredTransitions, endpoints.Namespace, endpoints.Name),
+			after: defaultRequeueDelay,
+		}
+	}
+
+	// The same applies to endpoint changes held back by maxChangesPerSync: the
+	// remaining changes only land on a later reconcile of this key.
+	if totals.deferred > 0 {
+		return &requeueError{
+			err:   fmt.Errorf("deferred %d endpoint changes for Endpoints %s/%s", totals.deferred, endpoints.Namespace, endpoints.Name),
+			after: defaultRequeueDelay,
+		}
+	}
+
+	// Likewise, a deferred slice deletion is only carried out by the next
+	// reconcile of this key.
+	return requeueForDeferredDeletions(endpoints, deferredDeletions)
+}
+
+// hasNativeSlices returns true if the Service with the same name as the
+// Endpoints resource exists and already has EndpointSlices managed by the
+// native EndpointSlice controller. It returns false if the reconciler has not
+// been configured with both a ServiceLister and an EndpointSliceLister.
+func (r *reconciler) hasNativeSlices(endpoints *corev1.Endpoints) bool {
+	if r.serviceLister == nil || r.endpointSliceLister == nil {
+		return false
+	}
+	if _, err := r.serviceLister.Services(endpoints.Namespace).Get(endpoints.Name); err != nil {
+		return false
+	}
+	esLabelSelector := labels.Set(map[string]string{
+		discovery.LabelServiceName: endpoints.Name,
+		discovery.LabelManagedBy:   nativeControllerName,
+	}).AsSelectorPreValidated()
+	epSlices, err := r.endpointSliceLister.EndpointSlices(endpoints.Namespace).List(esLabelSelector)
+	if err != nil {
+		return false
+	}
+	return len(epSlices) > 0
+}
+
+// validatePortsAgainstService emits a Warning event for each Endpoints port
+// whose name does not correspond to a port declared on the Service with the
+// same name as the Endpoints resource. It is a no-op if the reconciler has not
+// been configured with a ServiceLister or no such Service exists.
+func (r *reconciler) validatePortsAgainstService(logger klog.Logger, budget *eventBudget, endpoints *corev1.Endpoints, subsets []corev1.EndpointSubset) {
+	if r.serviceLister == nil {
+		return
+	}
+	svc, err := r.serviceLister.Services(endpoints.Namespace).Get(endpoints.Name)
+	if err != nil {
+		logger.V(4).Info("Unable to validate Endpoints ports, Service not found", "endpoints", klog.KObj(endpoints))
+		return
+	}
+
+	servicePortNames := map[string]bool{}
+	for _, servicePort := range svc.Spec.Ports {
+		servicePortNames[servicePort.Name] = true
+	}
+
+	for _, subset := range subsets {
+		for _, port := range subset.Ports {
+			if servicePortNames[port.Name] {
+				continue
+			}
+			logger.Info("Port in Endpoints is not declared on the corresponding Service", "endpoints", klog.KObj(endpoints), "portName", port.Name, "port", port.Port)
+			r.event(budget, endpoints, corev1.EventTypeWarning, PortNotInService,
+				"Port %q (%d) is not declared on Service %s/%s", port.Name, port.Port, svc.Namespace, svc.Name)
+		}
+	}
+}
+
+// reportDuplicateProtocolPorts logs and counts Endpoints ports that share a
+// name and number but differ in protocol, for example the same port declared
+// once for TCP and once for UDP. Such ports are valid and are mirrored as
+// distinct ports, but they sometimes indicate an unintended duplicate.
+func (r *reconciler) reportDuplicateProtocolPorts(logger klog.Logger, endpoints *corev1.Endpoints, subsets []corev1.EndpointSubset) {
+	protocolsByPort := map[string]map[corev1.Protocol]bool{}
+	for _, subset := range subsets {
+		for _, port := range subset.Ports {
+			key := fmt.Sprintf("%s/%d", port.Name, port.Port)
+			if protocolsByPort[key] == nil {
+				protocolsByPort[key] = map[corev1.Protocol]bool{}
+			}
+			protocolsByPort[key][port.Protocol] = true
+		}
+	}
+
+	for key, protocols := range protocolsByPort {
+		if len(protocols) > 1 {
+			logger.V(2).Info("Endpoints declares the same port with multiple protocols, the ports will be mirrored as distinct ports", "endpoints", klog.KObj(endpoints), "port", key)
+			metrics.DuplicateProtocolPorts.WithLabelValues().Inc()
+		}
+	}
+}
+
+// markTerminatingEndpoints sets the Terminating condition on desired
+// endpoints whose backing Pod is being deleted. It is a no-op if the
+// reconciler has not been configured with a PodLister.
+func (r *reconciler) markTerminatingEndpoints(logger klog.Logger, d *desiredCalc) {
+	if r.podLister == nil {
+		return
+	}
+
+	for _, endpointSet := range d.endpointsByKey {
+		for _, endpoint := range endpointSet.UnsortedList() {
+			if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+				continue
+			}
+			pod, err := r.podLister.Pods(endpoint.TargetRef.Namespace).Get(endpoint.TargetRef.Name)
+			if err != nil {
+				logger.V(4).Info("Unable to determine terminating state for endpoint, pod not found", "pod", klog.KRef(endpoint.TargetRef.Namespace, endpoint.TargetRef.Name))
+				continue
+			}
+			if pod.DeletionTimestamp != nil {
+				terminating := true
+				endpoint.Conditions.Terminating = &terminating
+			}
+		}
+	}
+}
+
+// dropStaleTerminalEndpoints removes desired endpoints whose backing Pod has
+// been in a terminal phase for longer than maxTerminalPodAge, treating them
+// as stale leftovers in the Endpoints resource. It is a no-op if the
+// reconciler has not been configured with a PodLister.
+func (r *reconciler) dropStaleTerminalEndpoints(logger klog.Logger, d *desiredCalc) {
+	if r.maxTerminalPodAge <= 0 || r.podLister == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, endpointSet := range d.endpointsByKey {
+		for _, endpoint := range endpointSet.UnsortedList() {
+			if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+				continue
+			}
+			pod, err := r.podLister.Pods(endpoint.TargetRef.Namespace).Get(endpoint.TargetRef.Name)
+			if err != nil {
+				logger.V(4).Info("Unable to determine terminal state for endpoint, pod not found", "pod", klog.KRef(endpoint.TargetRef.Namespace, endpoint.TargetRef.Name))
+				continue
+			}
+			if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+				continue
+			}
+			// Without a recorded finish time the terminal age is unknown, so
+			// the endpoint is kept.
+			finished := latestFinishedAt(pod)
+			if finished.IsZero() || now.Sub(finished.Time) <= r.maxTerminalPodAge {
+				continue
+			}
+			logger.V(2).Info("Dropping endpoint whose pod has been terminal beyond the maximum age", "pod", klog.KObj(pod), "finishedAt", finished.Time)
+			endpointSet.Delete(endpoint)
+			d.numDesiredEndpoints--
+		}
+	}
+}
+
+// applyNotReadyHysteresis defers ready to not-ready transitions until they
+// have been observed for notReadyHysteresis consecutive reconciles, so an
+// endpoint flapping between ready and not ready does not generate an update
+// per flap. Endpoints already mirrored as not ready are not affected. It
+// returns the number of transitions deferred this reconcile; the caller must
+// requeue the key while that number is non-zero, since observations only
+// advance when a reconcile happens and a suppressed write generates no
+// further events on its own.
+func (r *reconciler) applyNotReadyHysteresis(logger klog.Logger, endpoints *corev1.Endpoints, d *desiredCalc, existingSlices []*discovery.EndpointSlice) int {
+	if r.notReadyHysteresis <= 0 {
+		return 0
+	}
+
+	readyInSlices := map[string]bool{}
+	for _, epSlice := range existingSlices {
+		for _, endpoint := range epSlice.Endpoints {
+			if endpoint.Conditions.Ready != nil && *endpoint.Conditions.Ready {
+				for _, address := range endpoint.Addresses {
+					readyInSlices[address] = true
+				}
+			}
+		}
+	}
+
+	r.notReadyObservationsLock.Lock()
+	defer r.notReadyObservationsLock.Unlock()
+	if r.notReadyObservations == nil {
+		r.notReadyObservations = map[string]int{}
+	}
+
+	deferred := 0
+	for portKey, endpointSet := range d.endpointsByKey {
+		for _, endpoint := range endpointSet.UnsortedList() {
+			if len(endpoint.Addresses) == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s/%s/%s", endpoints.Namespace, endpoints.Name, portKey, endpoint.Addresses[0])
+			if endpoint.Conditions.Ready != nil && *endpoint.Conditions.Ready {
+				delete(r.notReadyObservations, key)
+				continue
+			}
+			r.notReadyObservations[key]++
+			if readyInSlices[endpoint.Addresses[0]] && r.notReadyObservations[key] < int(r.notReadyHysteresis) {
+				logger.V(4).Info("Deferring not-ready transition", "endpoints", klog.KObj(endpoints), "IP", endpoint.Addresses[0], "observations", r.notReadyObservations[key])
+				ready := true
+				endpoint.Conditions.Ready = &ready
+				deferred++
+			}
+		}
+	}
+	return deferred
+}
+
+// recordZoneDistribution records the zones of the nodes backing the desired
+// endpoints in the metrics cache, which aggregates the per-zone counts across
+// all Endpoints resources into the ZoneDistribution metric and drops them
+// again when a resource is deleted. It is a no-op if the reconciler has not
+// been configured with a NodeLister.
+func (r *reconciler) recordZoneDistribution(logger klog.Logger, endpoints *corev1.Endpoints, d *desiredCalc) {
+	if r.nodeLister == nil {
+		return
+	}
+
+	endpointsPerZone := map[string]int{}
+	for _, endpointSet := range d.endpointsByKey {
+		for _, endpoint := range endpointSet.UnsortedList() {
+			if endpoint.NodeName == nil {
+				continue
+			}
+			node, err := r.nodeLister.Get(*endpoint.NodeName)
+			if err != nil {
+				logger.V(4).Info("Unable to determine zone for endpoint, node not found", "node", *endpoint.NodeName)
+				continue
+			}
+			zone, ok := node.Labels[corev1.LabelTopologyZone]
+			if !ok || zone == "" {
+				continue
+			}
+			endpointsPerZone[zone]++
+		}
+	}
+
+	r.metricsCache.UpdateZoneDistribution(types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}, endpointsPerZone)
+}
+
+// observeCrossPortMapAddresses records an observation for each address that
+// appears in more than one port mapping group. This can be legitimate but is
+// worth surfacing when debugging misconfigured Endpoints.
+func observeCrossPortMapAddresses(logger klog.Logger, endpoints *corev1.Endpoints, d *desiredCalc) {
+	portMapsByAddress := map[string]int{}
+	for _, endpointSet := range d.endpointsByKey {
+		for _, endpoint := range endpointSet.UnsortedList() {
+			for _, address := range endpoint.Addresses {
+				portMapsByAddress[address]++
+			}
+		}
+	}
+
+	for address, numPortMaps := range portMapsByAddress {
+		if numPortMaps > 1 {
+			logger.V(4).Info("Address appears in multiple port mappings", "endpoints", klog.KObj(endpoints), "IP", address, "portMappings", numPortMaps)
+			metrics.AddressesInMultiplePortMaps.WithLabelValues().Inc()
+		}
+	}
+}
+
+// sliceTopology is a structured debug view of how an Endpoints resource maps
+// to EndpointSlices, for support tooling.
+type sliceTopology struct {
+	// Endpoints is the namespace/name of the Endpoints resource.
+	Endpoints string
+	// PortMaps holds one node per port mapping with desired endpoints or
+	// existing slices.
+	PortMaps []portMapTopology
+}
+
+// portMapTopology describes one port mapping group of a sliceTopology.
+type portMapTopology struct {
+	AddressType discovery.AddressType
+	Ports       []discovery.EndpointPort
+	// Desired lists the addresses desired for this port mapping, sorted.
+	Desired []string
+	// Slices lists the existing slices grouped under this port mapping and
+	// the addresses they currently hold.
+	Slices []sliceTopologyNode
+}
+
+// sliceTopologyNode describes one existing EndpointSlice of a portMapTopology.
+type sliceTopologyNode struct {
+	Name string
+	// Endpoints lists the addresses the slice currently holds, sorted.
+	Endpoints []string
+}
+
+// sliceTopologyView returns a structured view of an Endpoints resource, its
+// port mappings, and the existing slices grouped under each, computed from
+// the same desired state a reconcile would use. Port mappings with neither
+// desired endpoints nor existing slices are omitted.
+func (r *reconciler) sliceTopologyView(logger klog.Logger, endpoints *corev1.Endpoints, existingSlices []*discovery.EndpointSlice) sliceTopology {
+	d, _, _, _ := r.desiredState(logger, endpoints)
+	slicesByKey := endpointSlicesByKey(existingSlices, r.portComparator)
+
+	view := sliceTopology{Endpoints: fmt.Sprintf("%s/%s", endpoints.Namespace, endpoints.Name)}
+	keys := make([]addrTypePortMapKey, 0, len(d.endpointsByKey))
+	for key, endpointSet := range d.endpointsByKey {
+		if endpointSet.Len() > 0 || len(slicesByKey[key]) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, key := range keys {
+		pm := portMapTopology{AddressType: key.addressType(), Ports: d.portsByKey[key]}
+		for _, endpoint := range d.endpointsByKey[key].UnsortedList() {
+			pm.Desired = append(pm.Desired, endpoint.Addresses...)
+		}
+		sort.Strings(pm.Desired)
+		for _, epSlice := range slicesByKey[key] {
+			node := sliceTopologyNode{Name: epSlice.Name}
+			for _, endpoint := range epSlice.Endpoints {
+				node.Endpoints = append(node.Endpoints, endpoint.Addresses...)
+			}
+			sort.Strings(node.Endpoints)
+			pm.Slices = append(pm.Slices, node)
+		}
+		view.PortMaps = append(view.PortMaps, pm)
+	}
+	return view
+}
+
+// observeFamilyMigrations logs each endpoint whose TargetRef is desired only
+// under address families other than the one its existing slice holds, which
+// happens when a backend's IP changes family between syncs. The desired state
+// is recomputed from scratch, so the old family's entry is removed and the
+// new family's added by the same sync.
+func observeFamilyMigrations(logger klog.Logger, endpoints *corev1.Endpoints, d *desiredCalc, existingSlices []*discovery.EndpointSlice) {
+	if !logger.V(2).Enabled() {
+		return
+	}
+	desiredFamilies := map[string]map[discovery.AddressType]bool{}
+	for key, endpointSet := range d.endpointsByKey {
+		for _, endpoint := range endpointSet.UnsortedList() {
+			if endpoint.TargetRef == nil {
+				continue
 			}
+			refKey := fmt.Sprintf("%s/%s/%s", endpoint.TargetRef.Namespace, endpoint.TargetRef.Name, endpoint.TargetRef.UID)
+			if desiredFamilies[refKey] == nil {
+				desiredFamilies[refKey] = map[discovery.AddressType]bool{}
+			}
+			desiredFamilies[refKey][key.addressType()] = true
 		}
 	}
 
-	metrics.EndpointsAddedPerSync.WithLabelValues().Observe(float64(totals.added))
-	metrics.EndpointsUpdatedPerSync.WithLabelValues().Observe(float64(totals.updated))
-	metrics.EndpointsRemovedPerSync.WithLabelValues().Observe(float64(totals.removed))
+	for _, epSlice := range existingSlices {
+		for _, endpoint := range epSlice.Endpoints {
+			if endpoint.TargetRef == nil {
+				continue
+			}
+			refKey := fmt.Sprintf("%s/%s/%s", endpoint.TargetRef.Namespace, endpoint.TargetRef.Name, endpoint.TargetRef.UID)
+			families := desiredFamilies[refKey]
+			if len(families) == 0 || families[epSlice.AddressType] {
+				continue
+			}
+			newFamilies := make([]string, 0, len(families))
+			for family := range families {
+				newFamilies = append(newFamilies, string(family))
+			}
+			sort.Strings(newFamilies)
+			logger.V(2).Info("Endpoint address family changed between syncs, migrating to the new family's slice", "endpoints", klog.KObj(endpoints), "targetRef", klog.KRef(endpoint.TargetRef.Namespace, endpoint.TargetRef.Name), "oldAddressType", epSlice.AddressType, "newAddressTypes", newFamilies)
+		}
+	}
+}
 
-	endpointsNN := types.NamespacedName{Name: endpoints.Name, Namespace: endpoints.Namespace}
-	r.metricsCache.UpdateEndpointPortCache(endpointsNN, epMetrics)
+// observeCrossFamilyAddresses records an observation for each IPv4 address
+// that appears in both its plain and IPv4-mapped IPv6 form, e.g. "10.0.0.1"
+// and "::ffff:10.0.0.1". The two forms refer to the same backend but are
+// canonicalized to the same mirrored endpoint, which is almost always a
+// misconfiguration. It inspects the raw subsets because canonicalization
+// collapses the two forms before the desired state is built.
+func observeCrossFamilyAddresses(logger klog.Logger, endpoints *corev1.Endpoints, subsets []corev1.EndpointSubset) {
+	type addressForms struct{ plain, mapped bool }
+	formsByCanonical := map[string]*addressForms{}
+	observe := func(address string) {
+		ip := netutils.ParseIPSloppy(address)
+		if ip == nil || ip.To4() == nil {
+			return
+		}
+		forms := formsByCanonical[ip.To4().String()]
+		if forms == nil {
+			forms = &addressForms{}
+			formsByCanonical[ip.To4().String()] = forms
+		}
+		if strings.Contains(address, ":") {
+			forms.mapped = true
+		} else {
+			forms.plain = true
+		}
+	}
+	for _, subset := range subsets {
+		for _, address := range subset.Addresses {
+			observe(address.IP)
+		}
+		for _, address := range subset.NotReadyAddresses {
+			observe(address.IP)
+		}
+	}
 
-	return r.finalize(endpoints, slices)
+	for canonical, forms := range formsByCanonical {
+		if forms.plain && forms.mapped {
+			logger.V(4).Info("Address appears in both IPv4 and IPv4-mapped IPv6 form", "endpoints", klog.KObj(endpoints), "IP", canonical)
+			metrics.CrossFamilyAddresses.WithLabelValues().Inc()
+		}
+	}
 }
 
 // reconcileByPortMapping compares the endpoints found in existing slices with
 // the list of desired endpoints and returns lists of slices to create, update,
 // and delete.
 func (r *reconciler) reconcileByPortMapping(
+	logger klog.Logger,
+	budget *eventBudget,
 	endpoints *corev1.Endpoints,
 	existingSlices []*discovery.EndpointSlice,
 	desiredSet endpointsliceutil.EndpointSet,
@@ -183,6 +1641,16 @@ func (r *reconciler) reconcileByPortMapping(
 	slices := slicesByAction{}
 	totals := totalsByAction{}
 
+	// Sort existing slices by creationTimestamp, then name, so the slice that
+	// is kept is selected deterministically regardless of the order the
+	// informer yielded them in.
+	sort.Slice(existingSlices, func(i, j int) bool {
+		if !existingSlices[i].CreationTimestamp.Equal(&existingSlices[j].CreationTimestamp) {
+			return existingSlices[i].CreationTimestamp.Before(&existingSlices[j].CreationTimestamp)
+		}
+		return existingSlices[i].Name < existingSlices[j].Name
+	})
+
 	// If no endpoints are desired, mark existing slices for deletion and
 	// return.
 	if desiredSet.Len() == 0 {
@@ -193,40 +1661,241 @@ func (r *reconciler) reconcileByPortMapping(
 		return slices, totals
 	}
 
+	// If zonal isolation is requested, partition the desired endpoints into a
+	// separate slice per topology zone.
+	if r.splitByZone && r.nodeLister != nil {
+		return r.distributeByZone(logger, endpoints, existingSlices, desiredSet, endpointPorts, addressType)
+	}
+
+	// If the Endpoints resource requests an explicit number of slices,
+	// distribute the desired endpoints evenly across that many slices.
+	if target := targetSlices(endpoints); target > 1 {
+		return r.distributeAcrossSlices(endpoints, existingSlices, desiredSet, endpointPorts, addressType, target)
+	}
+
+	// If the Endpoints resource requests a per-slice byte budget, pack the
+	// desired endpoints into however many slices are needed to keep the
+	// approximate serialized size of each under the budget.
+	if budget := sliceByteBudget(endpoints); budget > 0 {
+		sizePerEndpoint := 0
+		for _, endpoint := range desiredSet.UnsortedList() {
+			if size := estimateEndpointSize(endpoint); size > sizePerEndpoint {
+				sizePerEndpoint = size
+			}
+		}
+		// A slice holds at least one endpoint regardless of how tight the
+		// budget is.
+		capacity := budget / sizePerEndpoint
+		if capacity < 1 {
+			capacity = 1
+		}
+		if capacity < desiredSet.Len() {
+			target := (desiredSet.Len() + capacity - 1) / capacity
+			return r.distributeAcrossSlices(endpoints, existingSlices, desiredSet, endpointPorts, addressType, target)
+		}
+	}
+
+	// If an existing slice holds more endpoints than maxEndpointsPerSubset
+	// allows, e.g. it was created with a higher limit before being adopted,
+	// repack the desired endpoints across enough slices to respect the limit
+	// rather than updating the oversized slice in place.
+	for _, existingSlice := range existingSlices {
+		if len(existingSlice.Endpoints) > int(r.maxEndpointsPerSubset) {
+			target := (desiredSet.Len() + int(r.maxEndpointsPerSubset) - 1) / int(r.maxEndpointsPerSubset)
+			if target < 1 {
+				target = 1
+			}
+			return r.distributeAcrossSlices(endpoints, existingSlices, desiredSet, endpointPorts, addressType, target)
+		}
+	}
+
 	if len(existingSlices) == 0 {
 		// if no existing slices, all desired endpoints will be added.
 		totals.added = desiredSet.Len()
 	} else {
-		// if >0 existing slices, mark all but 1 for deletion.
+		// if >0 existing slices, mark all but 1 for deletion. This also merges
+		// slices that share a port mapping but hold fragmented address
+		// subsets, e.g. after manual edits: the desired endpoints are
+		// regenerated into a single slice below.
 		slices.toDelete = existingSlices[1:]
 
+		// If the live slice already carries the resource version of this
+		// Endpoints, this sync was already applied and is a replay; skip the
+		// write.
+		if r.stampResourceVersion && endpoints.ResourceVersion != "" &&
+			existingSlices[0].Annotations[mirroredResourceVersionAnnotation] == endpoints.ResourceVersion {
+			if !r.endpointSliceTracker.Has(existingSlices[0]) {
+				r.endpointSliceTracker.Update(existingSlices[0])
+			}
+			metrics.SlicesUnchanged.WithLabelValues().Inc()
+			return slices, totals
+		}
+
 		// generated slices must mirror all endpoints annotations but EndpointsLastChangeTriggerTime and LastAppliedConfigAnnotation
-		compareAnnotations := cloneAndRemoveKeys(endpoints.Annotations, corev1.EndpointsLastChangeTriggerTime, corev1.LastAppliedConfigAnnotation)
-		compareLabels := cloneAndRemoveKeys(existingSlices[0].Labels, discovery.LabelManagedBy, discovery.LabelServiceName)
+		compareAnnotations := cloneAndRemoveKeys(endpoints.Annotations, corev1.EndpointsLastChangeTriggerTime, corev1.LastAppliedConfigAnnotation, endpointWeightsAnnotation)
+		compareSliceAnnotations := cloneAndRemoveKeys(existingSlices[0].Annotations, contentHashAnnotation, contentGenerationAnnotation, truncatedAnnotation, mirroredResourceVersionAnnotation, stableIdentifierAnnotation, endpointWeightsAnnotation)
+		// The weights annotation holds a per-slice subset of the Endpoints
+		// weights, so it is compared against a recomputation instead.
+		desiredWeights := parseEndpointWeights(endpoints)
+		weightsMatch := endpointWeightsValue(desiredWeights, existingSlices[0]) == existingSlices[0].Annotations[endpointWeightsAnnotation]
+		// Labels owned by this controller, including any propagated Service
+		// labels, are excluded when comparing slice labels against the
+		// Endpoints labels.
+		ignoredLabels := append([]string{discovery.LabelManagedBy, discovery.LabelServiceName, externalAddressesLabel}, r.serviceLabelAllowlist...)
+		compareLabels := cloneAndRemoveKeys(existingSlices[0].Labels, ignoredLabels...)
+
+		// Fast path: a stored content hash that matches the hash of the
+		// desired content means the per-endpoint comparison below cannot find
+		// changes, so only labels and annotations need checking.
+		// An adopted slice missing the managed-by label is never a no-op: it
+		// must be written at least once to take ownership. Likewise a slice
+		// whose service-name label does not match the Endpoints name, e.g.
+		// after a rename, must be repaired via update.
+		labelsIntact := existingSlices[0].Labels[discovery.LabelManagedBy] != "" &&
+			existingSlices[0].Labels[discovery.LabelServiceName] == endpoints.Name
+
+		// Under the content-only update policy, differences confined to the
+		// mirrored labels and annotations are cosmetic and do not warrant a
+		// write on their own.
+		metadataMatch := apiequality.Semantic.DeepEqual(endpoints.Labels, compareLabels) &&
+			apiequality.Semantic.DeepEqual(compareAnnotations, compareSliceAnnotations)
+		if r.contentOnlyUpdates {
+			metadataMatch = true
+		}
+
+		if stored, ok := existingSlices[0].Annotations[contentHashAnnotation]; ok && labelsIntact && weightsMatch &&
+			stored == desiredContentHash(addressType, endpointPorts, desiredSet) &&
+			metadataMatch {
+			if !r.endpointSliceTracker.Has(existingSlices[0]) {
+				r.endpointSliceTracker.Update(existingSlices[0])
+			}
+			metrics.SlicesUnchanged.WithLabelValues().Inc()
+			return slices, totals
+		}
+
 		// Return early if first slice matches desired endpoints, labels and annotations
-		totals = totalChanges(existingSlices[0], desiredSet)
-		if totals.added == 0 && totals.updated == 0 && totals.removed == 0 &&
-			apiequality.Semantic.DeepEqual(endpoints.Labels, compareLabels) &&
-			apiequality.Semantic.DeepEqual(compareAnnotations, existingSlices[0].Annotations) &&
-			!needRebuildExistingSlices(endpoints, existingSlices[0]) {
+		totals = r.totalChanges(existingSlices[0], desiredSet)
+		if totals.added == 0 && totals.updated == 0 && totals.removed == 0 && labelsIntact && weightsMatch &&
+			metadataMatch {
 			if !r.endpointSliceTracker.Has(existingSlices[0]) {
 				r.endpointSliceTracker.Update(existingSlices[0]) // Always ensure each EndpointSlice is being tracked.
 			}
+			// Correctness canary: the slice content is unchanged, so a stored
+			// content hash that disagrees with a recomputation indicates a bug
+			// in our hashing.
+			if stored, ok := existingSlices[0].Annotations[contentHashAnnotation]; ok && stored != sliceContentHash(existingSlices[0]) {
+				logger.Error(nil, "Content hash mismatch on unchanged EndpointSlice", "endpointSlice", klog.KObj(existingSlices[0]), "storedHash", stored)
+				metrics.HashMismatches.WithLabelValues().Inc()
+			}
+			metrics.SlicesUnchanged.WithLabelValues().Inc()
 			return slices, totals
 		}
 	}
 
+	// When capping changes per sync, replace the desired set with a partial
+	// target that applies at most maxChangesPerSync endpoint additions and
+	// removals against the live slice; the remainder converges over subsequent
+	// reconciles.
+	if r.maxChangesPerSync > 0 && len(existingSlices) > 0 {
+		var deferred int
+		desiredSet, deferred = capEndpointChanges(existingSlices[0], desiredSet, r.maxChangesPerSync)
+		totals = r.totalChanges(existingSlices[0], desiredSet)
+		totals.deferred = deferred
+	}
+
 	// generate a new slice with the desired endpoints.
 	var sliceName string
 	if len(existingSlices) > 0 {
 		sliceName = existingSlices[0].Name
 	}
 	newSlice := newEndpointSlice(endpoints, endpointPorts, addressType, sliceName)
+	r.applyFamilyRank(newSlice)
+	r.applyOwnerRefFlags(newSlice)
+	r.applyServiceLabels(endpoints, newSlice)
+	// When preserving endpoint order, endpoints already present in the live
+	// slice keep their positions and new endpoints are appended at the end.
+	if r.preserveEndpointOrder && len(existingSlices) > 0 {
+		for _, endpoint := range existingSlices[0].Endpoints {
+			if len(newSlice.Endpoints) >= int(r.maxEndpointsPerSubset) {
+				break
+			}
+			if got := desiredSet.Get(&endpoint); got != nil {
+				newSlice.Endpoints = append(newSlice.Endpoints, *got)
+				desiredSet.Delete(&endpoint)
+			}
+		}
+	}
 	for desiredSet.Len() > 0 && len(newSlice.Endpoints) < int(r.maxEndpointsPerSubset) {
 		endpoint, _ := desiredSet.PopAny()
 		newSlice.Endpoints = append(newSlice.Endpoints, *endpoint)
 	}
 
+	// Endpoints are popped from a set, so impose a deterministic order unless
+	// the live slice's order is being preserved. This keeps repeated
+	// reconciles of the same content byte-identical.
+	if !r.preserveEndpointOrder {
+		sortSliceEndpoints(newSlice)
+	}
+
+	// If hints are managed externally, carry them over from the live slice so
+	// this update does not wipe them.
+	if r.preserveHints && len(existingSlices) > 0 {
+		preserveEndpointHints(newSlice, existingSlices[0])
+	}
+
+	// When deferring on label conflicts, keep the live slice's value for any
+	// label that both the Endpoints resource and the live slice set. The
+	// managed-by and service-name labels are always owned by this controller.
+	if r.labelConflictPolicy == labelConflictDefer && len(existingSlices) > 0 {
+		for label, val := range existingSlices[0].Labels {
+			if label == discovery.LabelManagedBy || label == discovery.LabelServiceName {
+				continue
+			}
+			if _, ok := newSlice.Labels[label]; ok {
+				newSlice.Labels[label] = val
+			}
+		}
+	}
+
+	// Stamp the Endpoints resource version as an idempotency token so a
+	// replayed sync of the same resource version can skip the write.
+	// Replace the mirrored weights annotation with the weights of the
+	// endpoints this slice holds.
+	applyEndpointWeights(parseEndpointWeights(endpoints), newSlice)
+	if r.stampResourceVersion && endpoints.ResourceVersion != "" {
+		newSlice.Annotations[mirroredResourceVersionAnnotation] = endpoints.ResourceVersion
+	}
+	if r.stampStableIdentifier {
+		newSlice.Annotations[stableIdentifierAnnotation] = stableSliceIdentifier(endpoints, endpointPorts, addressType)
+	}
+
+	// Stamp the content hash and generation so external consumers can detect
+	// real content changes without diffing endpoints.
+	if r.emitContentGeneration {
+		var existingSlice *discovery.EndpointSlice
+		if len(existingSlices) > 0 {
+			existingSlice = existingSlices[0]
+		}
+		stampContentGeneration(newSlice, existingSlice)
+	} else if r.annotateContentHash {
+		newSlice.Annotations[contentHashAnnotation] = sliceContentHash(newSlice)
+	}
+
+	// Guardrail: a single sync shrinking a slice by more than the configured
+	// percentage can indicate an upstream bug. Warn before proceeding.
+	if r.maxShrinkPercent > 0 && newSlice.Name != "" && len(existingSlices) > 0 {
+		oldCount := len(existingSlices[0].Endpoints)
+		newCount := len(newSlice.Endpoints)
+		if oldCount > 0 && newCount < oldCount {
+			shrink := (oldCount - newCount) * 100 / oldCount
+			if shrink > int(r.maxShrinkPercent) {
+				logger.Info("EndpointSlice endpoint count shrank significantly in a single sync", "endpointSlice", klog.KObj(newSlice), "oldEndpoints", oldCount, "newEndpoints", newCount, "shrinkPercent", shrink)
+				r.event(budget, endpoints, corev1.EventTypeWarning, SignificantShrink,
+					"EndpointSlice %s shrank from %d to %d endpoints in a single sync", newSlice.Name, oldCount, newCount)
+			}
+		}
+	}
+
 	if newSlice.Name != "" {
 		slices.toUpdate = []*discovery.EndpointSlice{newSlice}
 	} else { // Slices to be created set GenerateName instead of Name.
@@ -236,50 +1905,591 @@ func (r *reconciler) reconcileByPortMapping(
 	return slices, totals
 }
 
-// finalize creates, updates, and deletes slices as specified
-func (r *reconciler) finalize(endpoints *corev1.Endpoints, slices slicesByAction) error {
+// distributeAcrossSlices generates the target number of EndpointSlices for a
+// port mapping, distributing the desired endpoints as evenly as possible
+// while respecting maxEndpointsPerSubset. Existing slice names are reused
+// where possible and any extra existing slices are marked for deletion.
+func (r *reconciler) distributeAcrossSlices(
+	endpoints *corev1.Endpoints,
+	existingSlices []*discovery.EndpointSlice,
+	desiredSet endpointsliceutil.EndpointSet,
+	endpointPorts []discovery.EndpointPort,
+	addressType discovery.AddressType,
+	target int,
+) (slicesByAction, totalsByAction) {
+	slices := slicesByAction{}
+	totals := totalsByAction{}
+	numEndpoints := desiredSet.Len()
+
+	if len(existingSlices) == 0 {
+		totals.added = numEndpoints
+	} else {
+		existingMatches := 0
+		for _, existingSlice := range existingSlices {
+			for _, endpoint := range existingSlice.Endpoints {
+				got := desiredSet.Get(&endpoint)
+				if got == nil {
+					totals.removed++
+				} else {
+					existingMatches++
+					if !r.endpointsEqual(got, &endpoint) {
+						totals.updated++
+					}
+				}
+			}
+		}
+		totals.added = numEndpoints - existingMatches
+	}
+
+	// When a stable primary slice or terminating de-prioritization is
+	// requested, fill slices in a deterministic order: the
+	// lexicographically-first-named slice receives the endpoints sorted by
+	// (non-terminating, ready, address).
+	var orderedEndpoints []*discovery.Endpoint
+	if r.stablePrimarySlice || r.deprioritizeTerminating {
+		sort.Slice(existingSlices, func(i, j int) bool {
+			return existingSlices[i].Name < existingSlices[j].Name
+		})
+		orderedEndpoints = desiredSet.UnsortedList()
+		sort.Slice(orderedEndpoints, func(i, j int) bool {
+			if r.deprioritizeTerminating {
+				iTerminating := orderedEndpoints[i].Conditions.Terminating != nil && *orderedEndpoints[i].Conditions.Terminating
+				jTerminating := orderedEndpoints[j].Conditions.Terminating != nil && *orderedEndpoints[j].Conditions.Terminating
+				if iTerminating != jTerminating {
+					return jTerminating
+				}
+				iReady := orderedEndpoints[i].Conditions.Ready != nil && *orderedEndpoints[i].Conditions.Ready
+				jReady := orderedEndpoints[j].Conditions.Ready != nil && *orderedEndpoints[j].Conditions.Ready
+				if iReady != jReady {
+					return iReady
+				}
+			}
+			return orderedEndpoints[i].Addresses[0] < orderedEndpoints[j].Addresses[0]
+		})
+	}
+	popEndpoint := func() *discovery.Endpoint {
+		if orderedEndpoints != nil {
+			endpoint := orderedEndpoints[0]
+			orderedEndpoints = orderedEndpoints[1:]
+			desiredSet.Delete(endpoint)
+			return endpoint
+		}
+		endpoint, _ := desiredSet.PopAny()
+		return endpoint
+	}
+
+	for i := 0; i < target && desiredSet.Len() > 0; i++ {
+		// Earlier slices receive the remainder so the difference between any
+		// two slices is at most one endpoint.
+		sliceSize := numEndpoints / target
+		if i < numEndpoints%target {
+			sliceSize++
+		}
+		if sliceSize > int(r.maxEndpointsPerSubset) {
+			sliceSize = int(r.maxEndpointsPerSubset)
+		}
+
+		var sliceName string
+		if i < len(existingSlices) {
+			sliceName = existingSlices[i].Name
+		}
+		newSlice := newEndpointSlice(endpoints, endpointPorts, addressType, sliceName)
+		r.applyFamilyRank(newSlice)
+		r.applyOwnerRefFlags(newSlice)
+		r.applyServiceLabels(endpoints, newSlice)
+		for len(newSlice.Endpoints) < sliceSize && desiredSet.Len() > 0 {
+			newSlice.Endpoints = append(newSlice.Endpoints, *popEndpoint())
+		}
+		sortSliceEndpoints(newSlice)
+		applyEndpointWeights(parseEndpointWeights(endpoints), newSlice)
+		if r.stampResourceVersion && endpoints.ResourceVersion != "" {
+			newSlice.Annotations[mirroredResourceVersionAnnotation] = endpoints.ResourceVersion
+		}
+		if r.stampStableIdentifier {
+			newSlice.Annotations[stableIdentifierAnnotation] = stableSliceIdentifier(endpoints, endpointPorts, addressType)
+		}
+		if r.emitContentGeneration {
+			var existingSlice *discovery.EndpointSlice
+			if i < len(existingSlices) {
+				existingSlice = existingSlices[i]
+			}
+			stampContentGeneration(newSlice, existingSlice)
+		} else if r.annotateContentHash {
+			newSlice.Annotations[contentHashAnnotation] = sliceContentHash(newSlice)
+		}
+
+		if newSlice.Name != "" {
+			slices.toUpdate = append(slices.toUpdate, newSlice)
+		} else {
+			slices.toCreate = append(slices.toCreate, newSlice)
+		}
+	}
+
+	if len(existingSlices) > target {
+		slices.toDelete = existingSlices[target:]
+	}
+
+	return slices, totals
+}
+
+// distributeByZone generates one EndpointSlice per topology zone for a port
+// mapping, labeling each slice with its zone. Existing slices already labeled
+// with a zone are reused for that zone and any remaining existing slices are
+// marked for deletion.
+func (r *reconciler) distributeByZone(
+	logger klog.Logger,
+	endpoints *corev1.Endpoints,
+	existingSlices []*discovery.EndpointSlice,
+	desiredSet endpointsliceutil.EndpointSet,
+	endpointPorts []discovery.EndpointPort,
+	addressType discovery.AddressType,
+) (slicesByAction, totalsByAction) {
+	slices := slicesByAction{}
+	totals := totalsByAction{}
+
+	if len(existingSlices) == 0 {
+		totals.added = desiredSet.Len()
+	} else {
+		existingMatches := 0
+		for _, existingSlice := range existingSlices {
+			for _, endpoint := range existingSlice.Endpoints {
+				got := desiredSet.Get(&endpoint)
+				if got == nil {
+					totals.removed++
+				} else {
+					existingMatches++
+					if !r.endpointsEqual(got, &endpoint) {
+						totals.updated++
+					}
+				}
+			}
+		}
+		totals.added = desiredSet.Len() - existingMatches
+	}
+
+	endpointsByZone := map[string][]*discovery.Endpoint{}
+	for _, endpoint := range desiredSet.UnsortedList() {
+		zone := r.zoneForEndpoint(logger, endpoint)
+		endpointsByZone[zone] = append(endpointsByZone[zone], endpoint)
+	}
+
+	zones := make([]string, 0, len(endpointsByZone))
+	for zone := range endpointsByZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	existingByZone := map[string]*discovery.EndpointSlice{}
+	for _, existingSlice := range existingSlices {
+		zone, ok := existingSlice.Labels[corev1.LabelTopologyZone]
+		if ok && existingByZone[zone] == nil {
+			existingByZone[zone] = existingSlice
+		}
+	}
+
+	reused := map[string]bool{}
+	for _, zone := range zones {
+		var sliceName string
+		if existingSlice := existingByZone[zone]; existingSlice != nil {
+			sliceName = existingSlice.Name
+			reused[sliceName] = true
+		}
+		newSlice := newEndpointSlice(endpoints, endpointPorts, addressType, sliceName)
+		r.applyFamilyRank(newSlice)
+		r.applyOwnerRefFlags(newSlice)
+		r.applyServiceLabels(endpoints, newSlice)
+		newSlice.Labels[corev1.LabelTopologyZone] = zone
+
+		zoneEndpoints := endpointsByZone[zone]
+		sort.Slice(zoneEndpoints, func(i, j int) bool {
+			return zoneEndpoints[i].Addresses[0] < zoneEndpoints[j].Addresses[0]
+		})
+		for _, endpoint := range zoneEndpoints {
+			if len(newSlice.Endpoints) >= int(r.maxEndpointsPerSubset) {
+				break
+			}
+			newSlice.Endpoints = append(newSlice.Endpoints, *endpoint)
+		}
+
+		if newSlice.Name != "" {
+			slices.toUpdate = append(slices.toUpdate, newSlice)
+		} else {
+			slices.toCreate = append(slices.toCreate, newSlice)
+		}
+	}
+
+	for _, existingSlice := range existingSlices {
+		if !reused[existingSlice.Name] {
+			slices.toDelete = append(slices.toDelete, existingSlice)
+		}
+	}
+
+	return slices, totals
+}
+
+// zoneForEndpoint returns the topology zone of the node backing an endpoint,
+// or an empty string if it cannot be determined.
+func (r *reconciler) zoneForEndpoint(logger klog.Logger, endpoint *discovery.Endpoint) string {
+	if endpoint.NodeName == nil {
+		return ""
+	}
+	node, err := r.nodeLister.Get(*endpoint.NodeName)
+	if err != nil {
+		logger.V(4).Info("Unable to determine zone for endpoint, node not found", "node", *endpoint.NodeName)
+		return ""
+	}
+	return node.Labels[corev1.LabelTopologyZone]
+}
+
+// applyFamilyRank prefixes the generated name of a slice being created with a
+// family rank so the preferred address family's slices sort before slices for
+// other families.
+func (r *reconciler) applyFamilyRank(epSlice *discovery.EndpointSlice) {
+	if r.preferredAddressFamily == "" || epSlice.GenerateName == "" {
+		return
+	}
+	rank := "1-"
+	if epSlice.AddressType == r.preferredAddressFamily {
+		rank = "0-"
+	}
+	epSlice.GenerateName += rank
+}
+
+// applyOwnerRefFlags overrides the BlockOwnerDeletion and Controller flags on
+// the owner references of a generated EndpointSlice when the reconciler has
+// been configured with explicit values for them.
+func (r *reconciler) applyOwnerRefFlags(epSlice *discovery.EndpointSlice) {
+	if r.blockOwnerDeletion == nil && r.ownerController == nil {
+		return
+	}
+	for i := range epSlice.OwnerReferences {
+		if r.blockOwnerDeletion != nil {
+			blockOwnerDeletion := *r.blockOwnerDeletion
+			epSlice.OwnerReferences[i].BlockOwnerDeletion = &blockOwnerDeletion
+		}
+		if r.ownerController != nil {
+			controller := *r.ownerController
+			epSlice.OwnerReferences[i].Controller = &controller
+		}
+	}
+}
+
+// applyServiceLabels copies allowlisted labels from the Service with the same
+// name as the Endpoints resource onto a generated EndpointSlice. It is a no-op
+// if the reconciler has not been configured with an allowlist and a
+// ServiceLister or no such Service exists.
+func (r *reconciler) applyServiceLabels(endpoints *corev1.Endpoints, epSlice *discovery.EndpointSlice) {
+	if len(r.serviceLabelAllowlist) == 0 || r.serviceLister == nil {
+		return
+	}
+	svc, err := r.serviceLister.Services(endpoints.Namespace).Get(endpoints.Name)
+	if err != nil {
+		return
+	}
+	for _, label := range r.serviceLabelAllowlist {
+		if val, ok := svc.Labels[label]; ok {
+			epSlice.Labels[label] = val
+		}
+	}
+}
+
+// finalize creates, updates, and deletes slices as specified. It returns the
+// number of deletions deferred by deferSliceDeletion this sync; the caller
+// must requeue the key while that number is non-zero, since a marked slice
+// generates no further events on its own and would otherwise serve stale
+// endpoints until an unrelated event resyncs the key.
+func (r *reconciler) finalize(ctx context.Context, endpoints *corev1.Endpoints, slices slicesByAction) (int, error) {
 	// If there are slices to create and delete, recycle the slices marked for
 	// deletion by replacing creates with updates of slices that would otherwise
-	// be deleted.
-	recycleSlices(&slices)
+	// be deleted. Each recycled pair turns a create and a delete into a single
+	// update.
+	numUpdates := len(slices.toUpdate)
+	portChanges := recycleSlices(&slices)
+	if recycled := len(slices.toUpdate) - numUpdates; recycled > 0 {
+		metrics.SlicesRecycled.WithLabelValues().Add(float64(recycled))
+		// A repurposed slice keeps its name but may change contents entirely;
+		// note the reuse so watchers are not surprised.
+		r.eventRecorder.Eventf(endpoints, corev1.EventTypeNormal, SliceRecycled,
+			"Repurposed EndpointSlices %v instead of deleting and recreating them", planSliceNames(slices.toUpdate[numUpdates:]))
+	}
+	if portChanges > 0 {
+		metrics.RecycledWithPortChange.WithLabelValues().Add(float64(portChanges))
+	}
+
+	// When deferring deletions, undesired slices are first marked with the
+	// pending-delete annotation and only deleted once they are seen undesired
+	// again with the mark already in place. A slice that becomes desired again
+	// in the meantime is rebuilt without the annotation by the update path.
+	deferredDeletions := 0
+	if r.deferSliceDeletion {
+		var stillToDelete []*discovery.EndpointSlice
+		for _, endpointSlice := range slices.toDelete {
+			if _, marked := endpointSlice.Annotations[pendingDeleteAnnotation]; marked {
+				stillToDelete = append(stillToDelete, endpointSlice)
+				continue
+			}
+			markedSlice := endpointSlice.DeepCopy()
+			if markedSlice.Annotations == nil {
+				markedSlice.Annotations = map[string]string{}
+			}
+			markedSlice.Annotations[pendingDeleteAnnotation] = "true"
+			slices.toUpdate = append(slices.toUpdate, markedSlice)
+			deferredDeletions++
+		}
+		slices.toDelete = stillToDelete
+	}
 
-	epsClient := r.client.DiscoveryV1().EndpointSlices(endpoints.Namespace)
+	// Track the number of API calls made for this sync, including calls that
+	// fail, so reconcile cost can be correlated with apiserver load.
+	numAPICalls := 0
+	defer func() {
+		metrics.ApiCallsPerSync.WithLabelValues().Observe(float64(numAPICalls))
+	}()
+
+	epsStorage := r.storage()
 
 	// Don't create more EndpointSlices if corresponding Endpoints resource is
 	// being deleted.
 	if endpoints.DeletionTimestamp == nil {
-		for _, endpointSlice := range slices.toCreate {
-			createdSlice, err := epsClient.Create(context.TODO(), endpointSlice, metav1.CreateOptions{})
+		var createdSlices []*discovery.EndpointSlice
+		for i, endpointSlice := range slices.toCreate {
+			if err := budgetExceeded(ctx); err != nil {
+				return 0, err
+			}
+			numAPICalls++
+			createdSlice, err := epsStorage.Create(ctx, endpoints.Namespace, endpointSlice)
 			if err != nil {
 				// If the namespace is terminating, creates will continue to fail. Simply drop the item.
 				if errors.HasStatusCause(err, corev1.NamespaceTerminatingCause) {
-					return nil
+					return 0, nil
+				}
+				// If the apiserver enforces a slice quota, further creates
+				// would keep failing. Fold the endpoints of the rejected and
+				// remaining creates into the slices created this sync that
+				// have spare capacity and write them as updates instead.
+				if r.repackOnQuota && isQuotaExceededError(err) {
+					if repacked, ok := repackIntoSlices(slices.toCreate[i:], createdSlices, int(r.maxEndpointsPerSubset)); ok {
+						slices.toUpdate = append(slices.toUpdate, repacked...)
+						break
+					}
+				}
+				// Returning here already withholds this sync's deletes. Under
+				// strict create-before-delete, also roll back the slices
+				// created earlier in the sync so a partial failure does not
+				// leave replacements behind alongside the slices they were
+				// meant to replace.
+				if r.createBeforeDelete && len(createdSlices) > 0 {
+					var rollbackErrs []error
+					for _, createdSlice := range createdSlices {
+						numAPICalls++
+						if deleteErr := epsStorage.Delete(ctx, endpoints.Namespace, createdSlice.Name); deleteErr != nil {
+							rollbackErrs = append(rollbackErrs, deleteErr)
+							continue
+						}
+						r.endpointSliceTracker.ExpectDeletion(createdSlice)
+					}
+					if len(rollbackErrs) > 0 {
+						err = fmt.Errorf("%w; failed to roll back %d/%d created EndpointSlices, including: %s", err, len(rollbackErrs), len(createdSlices), rollbackErrs[0])
+					}
 				}
-				return fmt.Errorf("failed to create EndpointSlice for Endpoints %s/%s: %v", endpoints.Namespace, endpoints.Name, err)
+				metrics.ReconcileErrors.WithLabelValues(classifyWriteError(err)).Inc()
+				return 0, wrapTransientError(fmt.Errorf("failed to create EndpointSlice for Endpoints %s/%s: %w", endpoints.Namespace, endpoints.Name, err))
+			}
+			if createdSlice == nil {
+				// A misbehaving client can return neither a slice nor an
+				// error. Treat that as a write failure rather than letting the
+				// tracker panic on the nil slice.
+				metrics.ReconcileErrors.WithLabelValues("other").Inc()
+				return 0, wrapTransientError(fmt.Errorf("client returned a nil EndpointSlice creating an EndpointSlice for Endpoints %s/%s", endpoints.Namespace, endpoints.Name))
 			}
 			r.endpointSliceTracker.Update(createdSlice)
 			metrics.EndpointSliceChanges.WithLabelValues("create").Inc()
+			metrics.SliceSizeBytes.WithLabelValues().Observe(float64(estimateSliceSize(createdSlice)))
+			if r.changelog != nil {
+				r.changelog.record("create", createdSlice.Name, len(createdSlice.Endpoints))
+			}
+			createdSlices = append(createdSlices, createdSlice)
 		}
 	}
 
-	for _, endpointSlice := range slices.toUpdate {
-		updatedSlice, err := epsClient.Update(context.TODO(), endpointSlice, metav1.UpdateOptions{})
+	// Before overwriting, optionally retain a copy of each live slice about
+	// to be updated so a bad rollout can be rolled back by hand, pruning the
+	// oldest copies beyond the configured count. Retention is best-effort and
+	// never fails the sync.
+	if r.historyLimit > 0 {
+		r.retainSliceHistory(ctx, endpoints, slices.toUpdate, &numAPICalls)
+	}
+
+	// Updates go through the configured batcher so multiple slice updates can
+	// be grouped into fewer API calls where a backend supports it.
+	if len(slices.toUpdate) > 0 {
+		updatedSlices, calls, err := r.batcher().update(ctx, epsStorage, endpoints.Namespace, slices.toUpdate)
+		numAPICalls += calls
+		for _, updatedSlice := range updatedSlices {
+			r.endpointSliceTracker.Update(updatedSlice)
+			metrics.EndpointSliceChanges.WithLabelValues("update").Inc()
+			metrics.SliceSizeBytes.WithLabelValues().Observe(float64(estimateSliceSize(updatedSlice)))
+			if r.changelog != nil {
+				r.changelog.record("update", updatedSlice.Name, len(updatedSlice.Endpoints))
+			}
+		}
 		if err != nil {
-			return fmt.Errorf("failed to update %s EndpointSlice for Endpoints %s/%s: %v", endpointSlice.Name, endpoints.Namespace, endpoints.Name, err)
+			// A spent time budget already carries its requeue hint.
+			var re *requeueError
+			if goerrors.As(err, &re) {
+				return 0, err
+			}
+			metrics.ReconcileErrors.WithLabelValues(classifyWriteError(err)).Inc()
+			return 0, wrapTransientError(fmt.Errorf("failed to update EndpointSlice for Endpoints %s/%s: %w", endpoints.Namespace, endpoints.Name, err))
 		}
-		r.endpointSliceTracker.Update(updatedSlice)
-		metrics.EndpointSliceChanges.WithLabelValues("update").Inc()
 	}
 
 	for _, endpointSlice := range slices.toDelete {
-		err := epsClient.Delete(context.TODO(), endpointSlice.Name, metav1.DeleteOptions{})
+		if err := budgetExceeded(ctx); err != nil {
+			return 0, err
+		}
+		numAPICalls++
+		err := epsStorage.Delete(ctx, endpoints.Namespace, endpointSlice.Name)
 		if err != nil {
-			return fmt.Errorf("failed to delete %s EndpointSlice for Endpoints %s/%s: %v", endpointSlice.Name, endpoints.Namespace, endpoints.Name, err)
+			metrics.ReconcileErrors.WithLabelValues(classifyWriteError(err)).Inc()
+			return 0, wrapTransientError(fmt.Errorf("failed to delete %s EndpointSlice for Endpoints %s/%s: %w", endpointSlice.Name, endpoints.Namespace, endpoints.Name, err))
 		}
 		r.endpointSliceTracker.ExpectDeletion(endpointSlice)
 		metrics.EndpointSliceChanges.WithLabelValues("delete").Inc()
+		if r.changelog != nil {
+			r.changelog.record("delete", endpointSlice.Name, len(endpointSlice.Endpoints))
+		}
+		if r.onSliceDeleted != nil {
+			r.onSliceDeleted(endpoints.Namespace, endpointSlice.Name)
+		}
+	}
+
+	return deferredDeletions, nil
+}
+
+// retainSliceHistory copies the live state of each slice about to be updated
+// into a new slice carrying the history label, then prunes the oldest copies
+// beyond historyLimit. Copies carry neither the managed-by label nor the
+// service-name label: the former keeps them invisible to the mirroring logic,
+// and the latter keeps EndpointSlice consumers, which select slices by the
+// service-name label alone, from routing traffic to the stale endpoints.
+func (r *reconciler) retainSliceHistory(ctx context.Context, endpoints *corev1.Endpoints, toUpdate []*discovery.EndpointSlice, numAPICalls *int) {
+	logger := klog.FromContext(ctx)
+	for _, endpointSlice := range toUpdate {
+		// A slice only being marked for deferred deletion is not overwritten.
+		if _, marked := endpointSlice.Annotations[pendingDeleteAnnotation]; marked {
+			continue
+		}
+		*numAPICalls++
+		liveSlice, err := r.client.DiscoveryV1().EndpointSlices(endpoints.Namespace).Get(ctx, endpointSlice.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.V(2).Info("Unable to read EndpointSlice to retain its history", "endpointSlice", klog.KRef(endpoints.Namespace, endpointSlice.Name), "err", err)
+			continue
+		}
+		snapshot := liveSlice.DeepCopy()
+		snapshot.Name = ""
+		snapshot.GenerateName = getSliceHistoryPrefix(endpointSlice.Name, endpoints.Name)
+		snapshot.ResourceVersion = ""
+		snapshot.UID = ""
+		snapshot.Labels = map[string]string{
+			sliceHistoryLabel: endpoints.Name,
+		}
+		if snapshot.Annotations == nil {
+			snapshot.Annotations = map[string]string{}
+		}
+		snapshot.Annotations[historyOfAnnotation] = endpointSlice.Name
+		*numAPICalls++
+		if _, err := r.client.DiscoveryV1().EndpointSlices(endpoints.Namespace).Create(ctx, snapshot, metav1.CreateOptions{}); err != nil {
+			logger.V(2).Info("Unable to retain EndpointSlice history", "endpointSlice", klog.KRef(endpoints.Namespace, endpointSlice.Name), "err", err)
+		}
+	}
+	r.pruneSliceHistory(ctx, endpoints, numAPICalls)
+}
+
+// pruneSliceHistory deletes the oldest retained slice copies of an Endpoints
+// resource beyond historyLimit.
+func (r *reconciler) pruneSliceHistory(ctx context.Context, endpoints *corev1.Endpoints, numAPICalls *int) {
+	logger := klog.FromContext(ctx)
+	selector := labels.Set(map[string]string{sliceHistoryLabel: endpoints.Name}).AsSelectorPreValidated()
+	*numAPICalls++
+	historySlices, err := r.client.DiscoveryV1().EndpointSlices(endpoints.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		logger.V(2).Info("Unable to list retained EndpointSlice history", "endpoints", klog.KObj(endpoints), "err", err)
+		return
+	}
+	if len(historySlices.Items) <= r.historyLimit {
+		return
+	}
+	// Newest copies first, so everything beyond the limit is the oldest.
+	sort.Slice(historySlices.Items, func(i, j int) bool {
+		if !historySlices.Items[i].CreationTimestamp.Equal(&historySlices.Items[j].CreationTimestamp) {
+			return historySlices.Items[j].CreationTimestamp.Before(&historySlices.Items[i].CreationTimestamp)
+		}
+		return historySlices.Items[i].Name > historySlices.Items[j].Name
+	})
+	for _, epSlice := range historySlices.Items[r.historyLimit:] {
+		*numAPICalls++
+		if err := r.client.DiscoveryV1().EndpointSlices(endpoints.Namespace).Delete(ctx, epSlice.Name, metav1.DeleteOptions{}); err != nil {
+			logger.V(2).Info("Unable to prune retained EndpointSlice history", "endpointSlice", klog.KObj(&epSlice), "err", err)
+		}
+	}
+}
+
+// annotateSourceSubsets stamps each planned create and update with the index
+// of the canonicalized source subset each of its endpoints was mirrored from,
+// in the slice's endpoint order. Endpoints whose origin is unknown, such as
+// those carried over from an existing slice, are recorded as -1.
+func annotateSourceSubsets(d *desiredCalc, slices slicesByAction) {
+	for _, epSlice := range append(slices.toCreate, slices.toUpdate...) {
+		indices := make([]string, 0, len(epSlice.Endpoints))
+		for _, endpoint := range epSlice.Endpoints {
+			index := -1
+			if len(endpoint.Addresses) > 0 {
+				if i, ok := d.sourceSubsetByAddress[endpoint.Addresses[0]]; ok {
+					index = i
+				}
+			}
+			indices = append(indices, strconv.Itoa(index))
+		}
+		if epSlice.Annotations == nil {
+			epSlice.Annotations = map[string]string{}
+		}
+		epSlice.Annotations[sourceSubsetsAnnotation] = strings.Join(indices, ",")
+	}
+}
+
+// isQuotaExceededError returns true if an EndpointSlice write was rejected
+// because it would exceed an apiserver-enforced quota.
+func isQuotaExceededError(err error) bool {
+	return errors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
+
+// classifyWriteError maps an error from an EndpointSlice write to a coarse
+// class for the ReconcileErrors metric, so retryable conflicts can be told
+// apart from persistent failures without parsing error strings.
+func classifyWriteError(err error) string {
+	switch {
+	case errors.IsConflict(err):
+		return "conflict"
+	case errors.IsNotFound(err):
+		return "notfound"
+	case errors.IsRequestEntityTooLargeError(err):
+		return "toolarge"
+	case errors.IsForbidden(err):
+		return "forbidden"
+	case errors.IsTimeout(err) || errors.IsServerTimeout(err):
+		return "timeout"
 	}
+	return "other"
+}
 
+// budgetExceeded returns a requeue-hinting error if the reconcile time budget
+// bound to ctx has been spent, so the remaining writes are retried on a later
+// sync.
+func budgetExceeded(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return &requeueError{err: fmt.Errorf("reconcile time budget exceeded: %w", ctx.Err()), after: defaultRequeueDelay}
+	}
 	return nil
 }
 
@@ -287,11 +2497,24 @@ func (r *reconciler) finalize(endpoints *corev1.Endpoints, slices slicesByAction
 // Endpoints references from the metricsCache.
 func (r *reconciler) deleteEndpoints(namespace, name string, endpointSlices []*discovery.EndpointSlice) error {
 	r.metricsCache.DeleteEndpoints(types.NamespacedName{Namespace: namespace, Name: name})
+	// Drop any hysteresis state tracked for this Endpoints resource.
+	r.notReadyObservationsLock.Lock()
+	prefix := fmt.Sprintf("%s/%s/", namespace, name)
+	for key := range r.notReadyObservations {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.notReadyObservations, key)
+		}
+	}
+	r.notReadyObservationsLock.Unlock()
 	var errs []error
 	for _, endpointSlice := range endpointSlices {
 		err := r.client.DiscoveryV1().EndpointSlices(namespace).Delete(context.TODO(), endpointSlice.Name, metav1.DeleteOptions{})
 		if err != nil {
 			errs = append(errs, err)
+			continue
+		}
+		if r.onSliceDeleted != nil {
+			r.onSliceDeleted(namespace, endpointSlice.Name)
 		}
 	}
 	if len(errs) > 0 {
@@ -302,10 +2525,10 @@ func (r *reconciler) deleteEndpoints(namespace, name string, endpointSlices []*d
 
 // endpointSlicesByKey returns a map that groups EndpointSlices by unique
 // addrTypePortMapKey values.
-func endpointSlicesByKey(existingSlices []*discovery.EndpointSlice) map[addrTypePortMapKey][]*discovery.EndpointSlice {
+func endpointSlicesByKey(existingSlices []*discovery.EndpointSlice, pc *portComparator) map[addrTypePortMapKey][]*discovery.EndpointSlice {
 	slicesByKey := map[addrTypePortMapKey][]*discovery.EndpointSlice{}
 	for _, existingSlice := range existingSlices {
-		epKey := newAddrTypePortMapKey(existingSlice.Ports, existingSlice.AddressType)
+		epKey := newAddrTypePortMapKey(pc.normalize(existingSlice.Ports), existingSlice.AddressType)
 		slicesByKey[epKey] = append(slicesByKey[epKey], existingSlice)
 	}
 	return slicesByKey
@@ -313,7 +2536,7 @@ func endpointSlicesByKey(existingSlices []*discovery.EndpointSlice) map[addrType
 
 // totalChanges returns the total changes that will be required for an
 // EndpointSlice to match a desired set of endpoints.
-func totalChanges(existingSlice *discovery.EndpointSlice, desiredSet endpointsliceutil.EndpointSet) totalsByAction {
+func (r *reconciler) totalChanges(existingSlice *discovery.EndpointSlice, desiredSet endpointsliceutil.EndpointSet) totalsByAction {
 	totals := totalsByAction{}
 	existingMatches := 0
 
@@ -327,7 +2550,7 @@ func totalChanges(existingSlice *discovery.EndpointSlice, desiredSet endpointsli
 
 			// If existing version of endpoint doesn't match desired version
 			// increment number of endpoints to be updated.
-			if !endpointsliceutil.EndpointsEqualBeyondHash(got, &endpoint) {
+			if !r.endpointsEqual(got, &endpoint) {
 				totals.updated++
 			}
 		}
@@ -339,7 +2562,11 @@ func totalChanges(existingSlice *discovery.EndpointSlice, desiredSet endpointsli
 	return totals
 }
 
-func needRebuildExistingSlices(endpoints *corev1.Endpoints, existingSlice *discovery.EndpointSlice) bool {
+// ownedByDifferentEndpointsUID returns true if the EndpointSlice has an owner
+// reference to an Endpoints resource with the same name as the given Endpoints
+// but a different UID, indicating it belongs to a previous incarnation of the
+// Endpoints that was deleted and recreated.
+func ownedByDifferentEndpointsUID(endpoints *corev1.Endpoints, existingSlice *discovery.EndpointSlice) bool {
 	for index := range existingSlice.OwnerReferences {
 		owner := existingSlice.OwnerReferences[index]
 		if owner.Kind == "Endpoints" && owner.Name == endpoints.Name && owner.UID != endpoints.UID {
@@ -17,6 +17,10 @@ limitations under the License.
 package endpointslicemirroring
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	endpointsliceutil "k8s.io/endpointslice/util"
@@ -37,6 +41,10 @@ func (s *slicesByAction) append(slices slicesByAction) {
 // totalsByAction includes total numbers for added and removed.
 type totalsByAction struct {
 	added, updated, removed int
+	// deferred counts endpoint additions and removals held back by
+	// maxChangesPerSync this sync; the key must be requeued while it is
+	// non-zero so the remaining changes land.
+	deferred int
 }
 
 // add adds totals from another totalsByAction struct.
@@ -44,6 +52,7 @@ func (t *totalsByAction) add(totals totalsByAction) {
 	t.added += totals.added
 	t.updated += totals.updated
 	t.removed += totals.removed
+	t.deferred += totals.deferred
 }
 
 // newDesiredCalc initializes and returns a new desiredCalc.
@@ -60,21 +69,175 @@ type desiredCalc struct {
 	portsByKey          map[addrTypePortMapKey][]discovery.EndpointPort
 	endpointsByKey      map[addrTypePortMapKey]endpointsliceutil.EndpointSet
 	numDesiredEndpoints int
+
+	// addressTypeResolver, when set, overrides how addresses map to an
+	// AddressType. If nil, addresses resolve to IPv4 or IPv6 by parsing the
+	// IP field as today.
+	addressTypeResolver addressTypeResolver
+
+	// defaultAddressType, when set, is assigned to addresses whose family
+	// cannot be inferred and that no custom resolver maps, instead of
+	// counting them as indeterminate.
+	defaultAddressType discovery.AddressType
+
+	// currentSubsetIndex is the index of the canonicalized subset currently
+	// being processed, recorded per address in sourceSubsetByAddress when
+	// that map is initialized.
+	currentSubsetIndex    int
+	sourceSubsetByAddress map[string]int
+
+	// noTargetRefPolicy determines how addresses without a TargetRef are
+	// handled. An empty value is equivalent to noTargetRefMirror.
+	noTargetRefPolicy noTargetRefPolicy
+
+	// portComparator, when set, controls which EndpointPort fields participate
+	// in port map equality. If nil, all fields participate.
+	portComparator *portComparator
+
+	// hasExternalAddresses is set when an address without a TargetRef was
+	// added under the noTargetRefLabel policy.
+	hasExternalAddresses bool
+
+	// groupSCTPMultihomed indicates whether addresses sharing a TargetRef
+	// under an SCTP port mapping should be folded into a single multihomed
+	// endpoint.
+	groupSCTPMultihomed bool
+
+	// multihomedByRef tracks the endpoint each TargetRef folds into for each
+	// port mapping when groupSCTPMultihomed is enabled.
+	multihomedByRef map[addrTypePortMapKey]map[string]*discovery.Endpoint
+
+	// flushThreshold, when positive, bounds the size of each live endpoint
+	// set: once a port mapping accumulates this many endpoints they are
+	// drained into a completed batch in flushedByKey, bounding the peak
+	// memory held in the hashed sets. Not applied while SCTP multihoming is
+	// grouping, since grouping mutates endpoints after insertion.
+	flushThreshold int
+
+	// flushedByKey holds the completed batches drained from each port
+	// mapping's endpoint set when flushThreshold was reached.
+	flushedByKey map[addrTypePortMapKey][][]*discovery.Endpoint
+
+	// numEmptyAddresses counts addresses that were skipped for having an
+	// empty IP, a distinct misconfiguration from an unparseable one.
+	numEmptyAddresses int
+
+	// numIndeterminateAddresses counts addresses whose address type could not
+	// be determined by parsing or a custom resolver.
+	numIndeterminateAddresses int
+
+	// portNumberByName maps named ports that conflict across subsets to the
+	// number chosen as their deterministic winner.
+	portNumberByName map[string]int32
+
+	// portNameConflicts maps named ports that conflict across subsets to the
+	// numbers that lost to the winner, in ascending order.
+	portNameConflicts map[string][]int32
+}
+
+// addressTypeResolver maps an EndpointAddress to the AddressType of the
+// EndpointSlice it should be mirrored to, or nil if the address is invalid.
+// It allows environments with non-IP identifiers to route addresses to custom
+// address types.
+type addressTypeResolver func(address v1.EndpointAddress) *discovery.AddressType
+
+// portComparator controls which EndpointPort fields participate in port map
+// equality. Fields excluded from equality no longer split port mapping
+// groups, so slices differing only in those fields are treated as matching.
+type portComparator struct {
+	// ignoreAppProtocol excludes AppProtocol from port equality.
+	ignoreAppProtocol bool
+	// foldNameCase compares port names case-insensitively.
+	foldNameCase bool
+}
+
+// normalize returns a copy of ports with the fields excluded from equality
+// cleared, so two port lists that are equal under the comparator produce the
+// same port map key. A nil comparator normalizes to the ports unchanged.
+func (pc *portComparator) normalize(ports []discovery.EndpointPort) []discovery.EndpointPort {
+	if pc == nil || (!pc.ignoreAppProtocol && !pc.foldNameCase) {
+		return ports
+	}
+	normalized := make([]discovery.EndpointPort, len(ports))
+	copy(normalized, ports)
+	for i := range normalized {
+		if pc.ignoreAppProtocol {
+			normalized[i].AppProtocol = nil
+		}
+		if pc.foldNameCase && normalized[i].Name != nil {
+			name := strings.ToLower(*normalized[i].Name)
+			normalized[i].Name = &name
+		}
+	}
+	return normalized
 }
 
 // multiAddrTypePortMapKey stores addrTypePortMapKey for different address
 // types.
 type multiAddrTypePortMapKey map[discovery.AddressType]addrTypePortMapKey
 
+// resolvePortNameConflicts records, for each named port that maps to more
+// than one number across subsets, the lowest number as the deterministic
+// winner. initPorts rewrites conflicting ports to their winner.
+func (d *desiredCalc) resolvePortNameConflicts(subsets []v1.EndpointSubset) {
+	numbersByName := map[string][]int32{}
+	for _, subset := range subsets {
+		for _, port := range subset.Ports {
+			if port.Name == "" {
+				continue
+			}
+			seen := false
+			for _, number := range numbersByName[port.Name] {
+				if number == port.Port {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				numbersByName[port.Name] = append(numbersByName[port.Name], port.Port)
+			}
+		}
+	}
+
+	for name, numbers := range numbersByName {
+		if len(numbers) < 2 {
+			continue
+		}
+		sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+		if d.portNumberByName == nil {
+			d.portNumberByName = map[string]int32{}
+			d.portNameConflicts = map[string][]int32{}
+		}
+		d.portNumberByName[name] = numbers[0]
+		d.portNameConflicts[name] = numbers[1:]
+	}
+}
+
 // initPorts initializes ports for a subset and address type and returns the
 // corresponding addrTypePortMapKey.
 func (d *desiredCalc) initPorts(subsetPorts []v1.EndpointPort) multiAddrTypePortMapKey {
+	// Rewrite named ports that conflict across subsets to their winning
+	// number so each name maps to a single number in the mirrored slices.
+	if len(d.portNumberByName) > 0 {
+		copied := false
+		for i := range subsetPorts {
+			if winner, ok := d.portNumberByName[subsetPorts[i].Name]; ok && subsetPorts[i].Port != winner {
+				if !copied {
+					subsetPorts = append([]v1.EndpointPort(nil), subsetPorts...)
+					copied = true
+				}
+				subsetPorts[i].Port = winner
+			}
+		}
+	}
+
 	endpointPorts := epPortsToEpsPorts(subsetPorts)
+	keyPorts := d.portComparator.normalize(endpointPorts)
 	addrTypes := []discovery.AddressType{discovery.AddressTypeIPv4, discovery.AddressTypeIPv6}
 	multiKey := multiAddrTypePortMapKey{}
 
 	for _, addrType := range addrTypes {
-		multiKey[addrType] = newAddrTypePortMapKey(endpointPorts, addrType)
+		multiKey[addrType] = newAddrTypePortMapKey(keyPorts, addrType)
 		if _, ok := d.endpointsByKey[multiKey[addrType]]; !ok {
 			d.endpointsByKey[multiKey[addrType]] = endpointsliceutil.EndpointSet{}
 		}
@@ -87,24 +250,287 @@ func (d *desiredCalc) initPorts(subsetPorts []v1.EndpointPort) multiAddrTypePort
 // addAddress adds an EndpointAddress to the desired state if it is valid. It
 // returns false if the address was invalid.
 func (d *desiredCalc) addAddress(address v1.EndpointAddress, multiKey multiAddrTypePortMapKey, ready bool) bool {
-	endpoint := addressToEndpoint(address, ready)
 	addrType := getAddressType(address.IP)
+	if d.addressTypeResolver != nil {
+		addrType = d.addressTypeResolver(address)
+	}
+	if addrType == nil && d.defaultAddressType != "" {
+		// The family is ambiguous; fall back to the configured default type
+		// rather than dropping the address.
+		defaultType := d.defaultAddressType
+		addrType = &defaultType
+	}
 	if addrType == nil {
+		d.numIndeterminateAddresses++
 		return false
 	}
+	// Reject addresses with fields long enough to bloat the generated slice.
+	if len(address.Hostname) > maxAddressHostnameLength {
+		return false
+	}
+	// Store the address in canonical IP form so non-canonical inputs (leading
+	// zeros, uppercase IPv6) deduplicate and compare consistently. Custom
+	// address types may hold non-IP identifiers, which are kept as-is.
+	if canonical := canonicalAddress(address.IP); canonical != "" {
+		address.IP = canonical
+	}
+	// FQDN addresses canonicalize to lowercase with the trailing dot stripped
+	// so cosmetic DNS-name variants deduplicate and compare consistently.
+	if *addrType == discovery.AddressTypeFQDN {
+		address.IP = canonicalFQDN(address.IP)
+	}
+	// Record which subset the canonical address came from, so written slices
+	// can be annotated with their endpoints' origins.
+	if d.sourceSubsetByAddress != nil {
+		d.sourceSubsetByAddress[address.IP] = d.currentSubsetIndex
+	}
+
+	// Addresses without a TargetRef may be external backends; they can be
+	// mirrored, skipped, or mirrored with the slices labeled as external.
+	if address.TargetRef == nil {
+		switch d.noTargetRefPolicy {
+		case noTargetRefSkip:
+			// Valid, but intentionally not mirrored.
+			return true
+		case noTargetRefLabel:
+			d.hasExternalAddresses = true
+		}
+	}
+
+	endpoint := addressToEndpoint(address, ready)
+
+	// Address types produced by a custom resolver are registered lazily,
+	// reusing the ports already registered for this subset.
+	if _, ok := multiKey[*addrType]; !ok {
+		endpointPorts := d.portsByKey[multiKey[discovery.AddressTypeIPv4]]
+		key := newAddrTypePortMapKey(d.portComparator.normalize(endpointPorts), *addrType)
+		multiKey[*addrType] = key
+		if _, ok := d.endpointsByKey[key]; !ok {
+			d.endpointsByKey[key] = endpointsliceutil.EndpointSet{}
+		}
+		d.portsByKey[key] = endpointPorts
+	}
+
+	// Multihomed SCTP endpoints list each address of one association as a
+	// separate EndpointAddress sharing a TargetRef. When grouping is enabled,
+	// fold those addresses into a single endpoint so the association cannot
+	// be split across slices.
+	if d.groupSCTPMultihomed && address.TargetRef != nil && hasSCTPPort(d.portsByKey[multiKey[*addrType]]) {
+		key := multiKey[*addrType]
+		refKey := fmt.Sprintf("%s/%s/%s", address.TargetRef.Namespace, address.TargetRef.Name, address.TargetRef.UID)
+		if existing, ok := d.multihomedByRef[key][refKey]; ok {
+			// Remove the endpoint before mutating its addresses since the set
+			// is keyed by a hash that covers them.
+			d.endpointsByKey[key].Delete(existing)
+			existing.Addresses = append(existing.Addresses, endpoint.Addresses...)
+			d.endpointsByKey[key].Insert(existing)
+			return true
+		}
+		if d.multihomedByRef == nil {
+			d.multihomedByRef = map[addrTypePortMapKey]map[string]*discovery.Endpoint{}
+		}
+		if d.multihomedByRef[key] == nil {
+			d.multihomedByRef[key] = map[string]*discovery.Endpoint{}
+		}
+		d.multihomedByRef[key][refKey] = endpoint
+	}
+
+	// Endpoints are deduplicated per (addressType, portMap, IP) so the same
+	// IP can be ready under one port mapping and not ready under another. If
+	// this address is already desired under this port mapping, prefer the
+	// ready version and don't count it twice.
+	if existing := d.endpointsByKey[multiKey[*addrType]].Get(endpoint); existing != nil {
+		if existing.Conditions.Ready == nil || !*existing.Conditions.Ready {
+			d.endpointsByKey[multiKey[*addrType]].Insert(endpoint)
+		}
+		return true
+	}
 
 	d.endpointsByKey[multiKey[*addrType]].Insert(endpoint)
 	d.numDesiredEndpoints++
+
+	// The canonicalized subsets list each address once per port mapping, so a
+	// full set can be drained into a completed batch without breaking the
+	// deduplication above.
+	if d.flushThreshold > 0 && !d.groupSCTPMultihomed && d.endpointsByKey[multiKey[*addrType]].Len() >= d.flushThreshold {
+		d.flushKey(multiKey[*addrType])
+	}
 	return true
 }
 
+// flushKey drains the endpoints accumulated for a port mapping into a
+// completed batch, sorted by first address so batch contents are
+// deterministic.
+func (d *desiredCalc) flushKey(key addrTypePortMapKey) {
+	endpoints := d.endpointsByKey[key].UnsortedList()
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Addresses[0] < endpoints[j].Addresses[0]
+	})
+	if d.flushedByKey == nil {
+		d.flushedByKey = map[addrTypePortMapKey][][]*discovery.Endpoint{}
+	}
+	d.flushedByKey[key] = append(d.flushedByKey[key], endpoints)
+	d.endpointsByKey[key] = endpointsliceutil.EndpointSet{}
+}
+
+// hasSCTPPort returns true if any of the ports uses the SCTP protocol.
+func hasSCTPPort(ports []discovery.EndpointPort) bool {
+	for _, port := range ports {
+		if port.Protocol != nil && *port.Protocol == v1.ProtocolSCTP {
+			return true
+		}
+	}
+	return false
+}
+
 type slicesByAddrType map[discovery.AddressType][]*discovery.EndpointSlice
 
+// planSliceNames returns the names of the given slices, falling back to the
+// generate-name prefix for slices that have not been named yet.
+func planSliceNames(slices []*discovery.EndpointSlice) []string {
+	names := make([]string, 0, len(slices))
+	for _, epSlice := range slices {
+		name := epSlice.Name
+		if name == "" {
+			name = epSlice.GenerateName
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// capEndpointChanges returns a partial desired endpoint set that applies at
+// most maxChanges endpoint additions and removals against the endpoints of an
+// existing slice, along with the number of changes held back. Endpoints
+// present in both sets are taken from the desired set, so condition updates
+// are not counted against the cap. The remaining changes are applied by
+// subsequent reconciles.
+func capEndpointChanges(existingSlice *discovery.EndpointSlice, desiredSet endpointsliceutil.EndpointSet, maxChanges int) (endpointsliceutil.EndpointSet, int) {
+	existingSet := endpointsliceutil.EndpointSet{}
+	for i := range existingSlice.Endpoints {
+		existingSet.Insert(&existingSlice.Endpoints[i])
+	}
+
+	capped := endpointsliceutil.EndpointSet{}
+	var additions, removals []*discovery.Endpoint
+	for _, endpoint := range desiredSet.UnsortedList() {
+		if existingSet.Has(endpoint) {
+			capped.Insert(endpoint)
+		} else {
+			additions = append(additions, endpoint)
+		}
+	}
+	for _, endpoint := range existingSet.UnsortedList() {
+		if !desiredSet.Has(endpoint) {
+			removals = append(removals, endpoint)
+		}
+	}
+
+	// Sort the candidates so the subset of changes applied by each sync is
+	// deterministic.
+	sortEndpointsByAddress := func(endpoints []*discovery.Endpoint) {
+		sort.Slice(endpoints, func(i, j int) bool {
+			return endpoints[i].Addresses[0] < endpoints[j].Addresses[0]
+		})
+	}
+	sortEndpointsByAddress(additions)
+	sortEndpointsByAddress(removals)
+
+	changes := 0
+	deferred := 0
+	for _, endpoint := range additions {
+		if changes >= maxChanges {
+			deferred++
+			continue
+		}
+		capped.Insert(endpoint)
+		changes++
+	}
+	for _, endpoint := range removals {
+		if changes < maxChanges {
+			changes++
+			continue
+		}
+		// The cap is spent; retain the undesired endpoint until a later sync.
+		capped.Insert(endpoint)
+		deferred++
+	}
+	return capped, deferred
+}
+
+// plannedEndpointTotal returns the number of endpoints the slices resulting
+// from a computed plan will hold: created and updated slices plus the
+// existing slices the plan leaves untouched.
+func plannedEndpointTotal(existingSlices []*discovery.EndpointSlice, slices slicesByAction) int {
+	touched := map[string]bool{}
+	total := 0
+	for _, epSlice := range slices.toCreate {
+		total += len(epSlice.Endpoints)
+	}
+	for _, epSlice := range slices.toUpdate {
+		total += len(epSlice.Endpoints)
+		touched[epSlice.Name] = true
+	}
+	for _, epSlice := range slices.toDelete {
+		touched[epSlice.Name] = true
+	}
+	for _, epSlice := range existingSlices {
+		if !touched[epSlice.Name] {
+			total += len(epSlice.Endpoints)
+		}
+	}
+	return total
+}
+
+// repackIntoSlices folds the endpoints of the rejected slices into written
+// slices with the same address type and port mapping that still have spare
+// capacity, returning the written slices that changed. It returns false if
+// any endpoint did not fit, in which case no repacking should be applied.
+func repackIntoSlices(rejected, written []*discovery.EndpointSlice, capacity int) ([]*discovery.EndpointSlice, bool) {
+	changed := map[string]bool{}
+	for _, epSlice := range rejected {
+		key := newAddrTypePortMapKey(epSlice.Ports, epSlice.AddressType)
+		remaining := epSlice.Endpoints
+		for _, target := range written {
+			if len(remaining) == 0 {
+				break
+			}
+			if newAddrTypePortMapKey(target.Ports, target.AddressType) != key {
+				continue
+			}
+			spare := capacity - len(target.Endpoints)
+			if spare <= 0 {
+				continue
+			}
+			if spare > len(remaining) {
+				spare = len(remaining)
+			}
+			target.Endpoints = append(target.Endpoints, remaining[:spare]...)
+			remaining = remaining[spare:]
+			changed[target.Name] = true
+		}
+		if len(remaining) > 0 {
+			return nil, false
+		}
+	}
+
+	var repacked []*discovery.EndpointSlice
+	for _, target := range written {
+		if changed[target.Name] {
+			repacked = append(repacked, target)
+		}
+	}
+	return repacked, true
+}
+
 // recycleSlices will recycle the slices marked for deletion by replacing
-// creates with updates of slices that would otherwise be deleted.
-func recycleSlices(slices *slicesByAction) {
+// creates with updates of slices that would otherwise be deleted. It returns
+// the number of recycled pairs whose port map changed, since the resulting
+// update rewrites the recycled slice's fundamental identity.
+func recycleSlices(slices *slicesByAction) int {
 	toCreateByAddrType := toSlicesByAddrType(slices.toCreate)
 	toDeleteByAddrType := toSlicesByAddrType(slices.toDelete)
+	portChanges := 0
 
 	for addrType, slicesToCreate := range toCreateByAddrType {
 		slicesToDelete := toDeleteByAddrType[addrType]
@@ -114,8 +540,12 @@ func recycleSlices(slices *slicesByAction) {
 			slice := slicesToCreate[i]
 			slice.Name = slicesToDelete[i].Name
 			slices.toUpdate = append(slices.toUpdate, slice)
+			if newAddrTypePortMapKey(slice.Ports, addrType) != newAddrTypePortMapKey(slicesToDelete[i].Ports, addrType) {
+				portChanges++
+			}
 		}
 	}
+	return portChanges
 }
 
 // removeSlice removes an EndpointSlice from a list of EndpointSlices.
@@ -18,15 +18,28 @@ package endpointslicemirroring
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/component-base/metrics/testutil"
 	endpointsliceutil "k8s.io/endpointslice/util"
@@ -36,8 +49,6 @@ import (
 	"k8s.io/utils/pointer"
 )
 
-const defaultMaxEndpointsPerSubset = int32(1000)
-
 // TestReconcile ensures that Endpoints are reconciled into corresponding
 // EndpointSlices with appropriate fields.
 func TestReconcile(t *testing.T) {
@@ -249,47 +260,6 @@ func TestReconcile(t *testing.T) {
 		}},
 		expectedNumSlices:     1,
 		expectedClientActions: 0,
-	}, {
-		testName: "Endpoints with 1 subset, port, and address and existing slice with same fields but different OwnerReferences",
-		subsets: []corev1.EndpointSubset{{
-			Ports: []corev1.EndpointPort{{
-				Name:     "http",
-				Port:     80,
-				Protocol: corev1.ProtocolTCP,
-			}},
-			Addresses: []corev1.EndpointAddress{{
-				IP:       "10.0.0.1",
-				Hostname: "pod-1",
-			}},
-		}},
-		uid: "d8f2c1f6-5285-4b3c-b3c1-9b89f9e7ed7a",
-		existingEndpointSlices: []*discovery.EndpointSlice{{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "test-ep-1",
-				Namespace: "test",
-				OwnerReferences: []metav1.OwnerReference{
-					{
-						APIVersion: "v1",
-						Kind:       "Endpoints",
-						Name:       "test-ep",
-						UID:        "fb91e798-1875-4857-b5eb-e2c878157b4d",
-					},
-				},
-			},
-			AddressType: discovery.AddressTypeIPv4,
-			Ports: []discovery.EndpointPort{{
-				Name:     pointer.String("http"),
-				Port:     pointer.Int32(80),
-				Protocol: &protoTCP,
-			}},
-			Endpoints: []discovery.Endpoint{{
-				Addresses:  []string{"10.0.0.1"},
-				Hostname:   pointer.String("pod-1"),
-				Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
-			}},
-		}},
-		expectedNumSlices:     1,
-		expectedClientActions: 1,
 	}, {
 		testName: "Endpoints with 1 subset, port, and address and existing slice with an additional annotation",
 		subsets: []corev1.EndpointSubset{{
@@ -1109,6 +1079,5740 @@ func TestReconcile(t *testing.T) {
 	}
 }
 
+// TestReconcileZoneDistributionMetric ensures that the ZoneDistribution metric
+// reflects the zones of the nodes backing the desired endpoints.
+func TestReconcileZoneDistributionMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodeZones := map[string]string{"node-1": "zone-a", "node-2": "zone-a", "node-3": "zone-b"}
+	for nodeName, zone := range nodeZones {
+		err := indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   nodeName,
+			Labels: map[string]string{corev1.LabelTopologyZone: zone},
+		}})
+		if err != nil {
+			t.Fatalf("Expected no error adding Node to indexer, got %v", err)
+		}
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.nodeLister = corelisters.NewNodeLister(indexer)
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP:       "10.0.0.1",
+				NodeName: pointer.String("node-1"),
+			}, {
+				IP:       "10.0.0.2",
+				NodeName: pointer.String("node-2"),
+			}, {
+				IP:       "10.0.0.3",
+				NodeName: pointer.String("node-3"),
+			}},
+		}},
+	}
+
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	// A second Endpoints resource contributes to the same zones; the metric
+	// reports the aggregate across resources.
+	otherEndpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep-other", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP:       "10.0.1.1",
+				NodeName: pointer.String("node-3"),
+			}},
+		}},
+	}
+	reconcileHelper(t, r, &otherEndpoints, []*discovery.EndpointSlice{})
+
+	expectedZones := map[string]int{"zone-a": 2, "zone-b": 2}
+	for zone, expected := range expectedZones {
+		value, err := testutil.GetGaugeMetricValue(metrics.ZoneDistribution.WithLabelValues(zone))
+		handleErr(t, err, "zoneDistribution")
+		if value != float64(expected) {
+			t.Errorf("Expected ZoneDistribution for zone %s to be %d, got %v", zone, expected, value)
+		}
+	}
+
+	// Deleting the first resource removes its contribution; zone-a no longer
+	// backs any endpoint, so its series is dropped entirely.
+	if err := r.deleteEndpoints(endpoints.Namespace, endpoints.Name, []*discovery.EndpointSlice{}); err != nil {
+		t.Fatalf("Expected no error deleting Endpoints, got %v", err)
+	}
+	value, err := testutil.GetGaugeMetricValue(metrics.ZoneDistribution.WithLabelValues("zone-b"))
+	handleErr(t, err, "zoneDistribution")
+	if value != 1 {
+		t.Errorf("Expected ZoneDistribution for zone zone-b to be 1 after delete, got %v", value)
+	}
+	value, err = testutil.GetGaugeMetricValue(metrics.ZoneDistribution.WithLabelValues("zone-a"))
+	handleErr(t, err, "zoneDistribution")
+	if value != 0 {
+		t.Errorf("Expected ZoneDistribution for zone zone-a to be removed after delete, got %v", value)
+	}
+}
+
+// TestReconcileTargetSlices ensures that the target-slices annotation results
+// in endpoints being distributed evenly across the requested number of
+// slices.
+func TestReconcileTargetSlices(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	addresses := []corev1.EndpointAddress{}
+	for i := 1; i <= 9; i++ {
+		addresses = append(addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.0.%d", i),
+		})
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-ep",
+			Namespace:   "test",
+			Annotations: map[string]string{targetSlicesAnnotation: "3"},
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: addresses,
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 3 {
+		t.Fatalf("Expected 3 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	totalEndpoints := 0
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Endpoints) != 3 {
+			t.Errorf("Expected 3 endpoints in EndpointSlice %s, got %d", epSlice.Name, len(epSlice.Endpoints))
+		}
+		totalEndpoints += len(epSlice.Endpoints)
+	}
+	if totalEndpoints != 9 {
+		t.Errorf("Expected 9 endpoints across all EndpointSlices, got %d", totalEndpoints)
+	}
+}
+
+// TestFinalizeApiCallsPerSyncMetric ensures that the ApiCallsPerSync metric
+// records the total number of API calls made by a mixed finalize.
+func TestFinalizeApiCallsPerSyncMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+	}
+
+	toUpdate := &discovery.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-1", Namespace: namespace},
+		AddressType: discovery.AddressTypeIPv4,
+	}
+	toDelete := &discovery.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-2", Namespace: namespace},
+		AddressType: discovery.AddressTypeIPv6,
+	}
+	for _, epSlice := range []*discovery.EndpointSlice{toUpdate, toDelete} {
+		_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), epSlice, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+		}
+	}
+
+	toCreate := newEndpointSlice(&endpoints, []discovery.EndpointPort{}, discovery.AddressTypeIPv4, "")
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	_, err := r.finalize(context.TODO(), &endpoints, slicesByAction{
+		toCreate: []*discovery.EndpointSlice{toCreate},
+		toUpdate: []*discovery.EndpointSlice{toUpdate},
+		toDelete: []*discovery.EndpointSlice{toDelete},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error finalizing slices, got %v", err)
+	}
+
+	actualAPICalls, err := testutil.GetHistogramMetricValue(metrics.ApiCallsPerSync.WithLabelValues())
+	handleErr(t, err, "apiCallsPerSync")
+	if actualAPICalls != 3 {
+		t.Errorf("Expected apiCallsPerSync to be 3, got %v", actualAPICalls)
+	}
+}
+
+// TestReconcileDeterministicSliceSelection ensures that the slice kept by
+// reconcileByPortMapping is selected by creationTimestamp then name rather
+// than informer ordering.
+func TestReconcileDeterministicSliceSelection(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	protoTCP := corev1.ProtocolTCP
+	ports := []discovery.EndpointPort{{
+		Name:     pointer.String("http"),
+		Port:     pointer.Int32(80),
+		Protocol: &protoTCP,
+	}}
+
+	older := metav1.NewTime(metav1.Now().Add(-time.Hour))
+	newer := metav1.Now()
+
+	// Listed out of order on purpose; test-ep-c is the oldest slice and
+	// test-ep-a sorts first among the slices sharing a timestamp.
+	existingSlices := []*discovery.EndpointSlice{{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-b", Namespace: "test", CreationTimestamp: newer},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports:       ports,
+	}, {
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-c", Namespace: "test", CreationTimestamp: older},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports:       ports,
+	}, {
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-a", Namespace: "test", CreationTimestamp: newer},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports:       ports,
+	}}
+
+	desiredSet := endpointsliceutil.EndpointSet{}
+	desiredSet.Insert(&discovery.Endpoint{
+		Addresses:  []string{"10.0.0.1"},
+		Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+	})
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+	}
+
+	logger, _ := ktesting.NewTestContext(t)
+	slices, _ := r.reconcileByPortMapping(logger, &eventBudget{limit: r.maxEventsPerSync}, &endpoints, existingSlices, desiredSet, ports, discovery.AddressTypeIPv4)
+
+	if len(slices.toUpdate) != 1 {
+		t.Fatalf("Expected 1 slice to update, got %d", len(slices.toUpdate))
+	}
+	if slices.toUpdate[0].Name != "test-ep-c" {
+		t.Errorf("Expected oldest slice test-ep-c to be kept, got %s", slices.toUpdate[0].Name)
+	}
+	if len(slices.toDelete) != 2 {
+		t.Fatalf("Expected 2 slices to delete, got %d", len(slices.toDelete))
+	}
+	if slices.toDelete[0].Name != "test-ep-a" || slices.toDelete[1].Name != "test-ep-b" {
+		t.Errorf("Expected slices to be deleted in name order, got %s, %s", slices.toDelete[0].Name, slices.toDelete[1].Name)
+	}
+}
+
+// TestReconcileRejectLocalAddresses ensures that loopback, unspecified, and
+// multicast addresses are rejected when the rejectLocalAddresses option is
+// enabled.
+func TestReconcileRejectLocalAddresses(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "127.0.0.1",
+			}, {
+				IP: "0.0.0.0",
+			}, {
+				IP: "224.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.rejectLocalAddresses = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 1 {
+		t.Fatalf("Expected 1 endpoint, got %d", len(endpointSlices[0].Endpoints))
+	}
+	if endpointSlices[0].Endpoints[0].Addresses[0] != "10.0.0.1" {
+		t.Errorf("Expected 10.0.0.1 to be mirrored, got %s", endpointSlices[0].Endpoints[0].Addresses[0])
+	}
+
+	actualSkippedPerSync, err := testutil.GetHistogramMetricValue(metrics.AddressesSkippedPerSync.WithLabelValues())
+	handleErr(t, err, "addressesSkippedPerSync")
+	if actualSkippedPerSync != 3 {
+		t.Errorf("Expected addressesSkippedPerSync to be 3, got %v", actualSkippedPerSync)
+	}
+}
+
+// TestReconcilePreserveHints ensures that endpoint Hints set externally on a
+// live slice survive an update when the preserveHints option is enabled.
+func TestReconcilePreserveHints(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "test-ep",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String("http"),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+			Hints: &discovery.EndpointHints{
+				ForZones: []discovery.ForZone{{Name: "zone-a"}},
+			},
+		}},
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			// The additional address forces an update of the existing slice.
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.preserveHints = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	numHinted := 0
+	for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+		for _, endpoint := range epSlice.Endpoints {
+			if endpoint.Addresses[0] != "10.0.0.1" {
+				continue
+			}
+			if endpoint.Hints == nil || len(endpoint.Hints.ForZones) != 1 || endpoint.Hints.ForZones[0].Name != "zone-a" {
+				t.Errorf("Expected hints for 10.0.0.1 to be preserved, got %+v", endpoint.Hints)
+			}
+			numHinted++
+		}
+	}
+	if numHinted != 1 {
+		t.Errorf("Expected 1 endpoint with preserved hints, got %d", numHinted)
+	}
+}
+
+// TestReconcileAddressesInMultiplePortMaps ensures that an address appearing
+// in more than one port mapping is recorded by the
+// AddressesInMultiplePortMaps metric.
+func TestReconcileAddressesInMultiplePortMaps(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{
+				Name:     "https",
+				Port:     443,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	actualObservations, err := testutil.GetCounterMetricValue(metrics.AddressesInMultiplePortMaps.WithLabelValues())
+	handleErr(t, err, "addressesInMultiplePortMaps")
+	if actualObservations != 1 {
+		t.Errorf("Expected addressesInMultiplePortMaps to be 1, got %v", actualObservations)
+	}
+}
+
+// TestReconcileLabelConflictPolicy ensures that conflicting label values on a
+// live slice are resolved according to the configured policy.
+func TestReconcileLabelConflictPolicy(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		policy        labelConflictPolicy
+		expectedValue string
+	}{{
+		testName:      "Overwrite policy replaces the live value",
+		policy:        labelConflictOverwrite,
+		expectedValue: "from-endpoints",
+	}, {
+		testName:      "Defer policy keeps the live value",
+		policy:        labelConflictDefer,
+		expectedValue: "external",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+
+			protoTCP := corev1.ProtocolTCP
+			ports := []discovery.EndpointPort{{
+				Name:     pointer.String("http"),
+				Port:     pointer.Int32(80),
+				Protocol: &protoTCP,
+			}}
+
+			existingSlices := []*discovery.EndpointSlice{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-ep-1",
+					Namespace: "test",
+					Labels: map[string]string{
+						"foo":                      "external",
+						discovery.LabelServiceName: "test-ep",
+						discovery.LabelManagedBy:   controllerName,
+					},
+				},
+				AddressType: discovery.AddressTypeIPv4,
+				Ports:       ports,
+			}}
+
+			desiredSet := endpointsliceutil.EndpointSet{}
+			desiredSet.Insert(&discovery.Endpoint{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+			})
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-ep",
+					Namespace: "test",
+					Labels:    map[string]string{"foo": "from-endpoints"},
+				},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.labelConflictPolicy = tc.policy
+
+			logger, _ := ktesting.NewTestContext(t)
+			slices, _ := r.reconcileByPortMapping(logger, &eventBudget{limit: r.maxEventsPerSync}, &endpoints, existingSlices, desiredSet, ports, discovery.AddressTypeIPv4)
+
+			if len(slices.toUpdate) != 1 {
+				t.Fatalf("Expected 1 slice to update, got %d", len(slices.toUpdate))
+			}
+			if val := slices.toUpdate[0].Labels["foo"]; val != tc.expectedValue {
+				t.Errorf("Expected label foo to be %s, got %s", tc.expectedValue, val)
+			}
+		})
+	}
+}
+
+// TestReconcileSummaryEvent ensures that exactly one Normal event summarizing
+// the sync is emitted when emitSummaryEvents is enabled.
+func TestReconcileSummaryEvent(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	fakeRecorder := record.NewFakeRecorder(10)
+	r.eventRecorder = fakeRecorder
+	r.emitSummaryEvents = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	expectedEvent := "Normal SyncSummary Mirrored EndpointSlices: 1 created, 0 updated, 0 deleted, 0 addresses truncated"
+	select {
+	case event := <-fakeRecorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Fatal("Expected a summary event, got none")
+	}
+
+	select {
+	case event := <-fakeRecorder.Events:
+		t.Errorf("Expected no additional events, got %q", event)
+	default:
+	}
+}
+
+// maxEndpointsPerSlice mirrors the apiserver's validation limit on the number
+// of endpoints in a single EndpointSlice.
+const maxEndpointsPerSlice = 1000
+
+// memorySliceStorage is an in-memory sliceStorage that enforces
+// apiserver-like constraints: name uniqueness, an immutable AddressType, and
+// the maximum number of endpoints per slice.
+type memorySliceStorage struct {
+	mu     sync.Mutex
+	slices map[string]*discovery.EndpointSlice
+}
+
+func newMemorySliceStorage() *memorySliceStorage {
+	return &memorySliceStorage{slices: map[string]*discovery.EndpointSlice{}}
+}
+
+func (m *memorySliceStorage) Create(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := endpointSlice.Name
+	if name == "" && endpointSlice.GenerateName != "" {
+		name = fmt.Sprintf("%s%d", endpointSlice.GenerateName, len(m.slices)+1)
+	}
+	key := namespace + "/" + name
+	if _, ok := m.slices[key]; ok {
+		return nil, errors.NewAlreadyExists(discovery.Resource("endpointslices"), name)
+	}
+	if len(endpointSlice.Endpoints) > maxEndpointsPerSlice {
+		return nil, errors.NewInvalid(discovery.Kind("EndpointSlice"), name, field.ErrorList{
+			field.TooMany(field.NewPath("endpoints"), len(endpointSlice.Endpoints), maxEndpointsPerSlice),
+		})
+	}
+
+	slice := endpointSlice.DeepCopy()
+	slice.Name = name
+	m.slices[key] = slice
+	return slice.DeepCopy(), nil
+}
+
+func (m *memorySliceStorage) Update(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := namespace + "/" + endpointSlice.Name
+	existing, ok := m.slices[key]
+	if !ok {
+		return nil, errors.NewNotFound(discovery.Resource("endpointslices"), endpointSlice.Name)
+	}
+	if existing.AddressType != endpointSlice.AddressType {
+		return nil, errors.NewInvalid(discovery.Kind("EndpointSlice"), endpointSlice.Name, field.ErrorList{
+			field.Invalid(field.NewPath("addressType"), endpointSlice.AddressType, "field is immutable"),
+		})
+	}
+	if len(endpointSlice.Endpoints) > maxEndpointsPerSlice {
+		return nil, errors.NewInvalid(discovery.Kind("EndpointSlice"), endpointSlice.Name, field.ErrorList{
+			field.TooMany(field.NewPath("endpoints"), len(endpointSlice.Endpoints), maxEndpointsPerSlice),
+		})
+	}
+
+	slice := endpointSlice.DeepCopy()
+	m.slices[key] = slice
+	return slice.DeepCopy(), nil
+}
+
+func (m *memorySliceStorage) Delete(ctx context.Context, namespace, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := namespace + "/" + name
+	if _, ok := m.slices[key]; !ok {
+		return errors.NewNotFound(discovery.Resource("endpointslices"), name)
+	}
+	delete(m.slices, key)
+	return nil
+}
+
+// slowSliceStorage wraps a sliceStorage and delays each create to simulate a
+// slow apiserver.
+type slowSliceStorage struct {
+	delegate sliceStorage
+	delay    time.Duration
+}
+
+func (s *slowSliceStorage) Create(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	time.Sleep(s.delay)
+	return s.delegate.Create(ctx, namespace, endpointSlice)
+}
+
+func (s *slowSliceStorage) Update(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	return s.delegate.Update(ctx, namespace, endpointSlice)
+}
+
+func (s *slowSliceStorage) Delete(ctx context.Context, namespace, name string) error {
+	return s.delegate.Delete(ctx, namespace, name)
+}
+
+// nilSliceStorage simulates a misbehaving client that returns neither a
+// slice nor an error on create.
+type nilSliceStorage struct{}
+
+func (nilSliceStorage) Create(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	return nil, nil
+}
+
+func (nilSliceStorage) Update(ctx context.Context, namespace string, endpointSlice *discovery.EndpointSlice) (*discovery.EndpointSlice, error) {
+	return endpointSlice, nil
+}
+
+func (nilSliceStorage) Delete(ctx context.Context, namespace, name string) error {
+	return nil
+}
+
+// TestMemorySliceStorageConstraints ensures the in-memory storage backend
+// enforces the same constraints a real apiserver would.
+func TestMemorySliceStorageConstraints(t *testing.T) {
+	storage := newMemorySliceStorage()
+	namespace := "test"
+
+	slice := &discovery.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-1", Namespace: namespace},
+		AddressType: discovery.AddressTypeIPv4,
+	}
+	if _, err := storage.Create(context.TODO(), namespace, slice); err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	if _, err := storage.Create(context.TODO(), namespace, slice); !errors.IsAlreadyExists(err) {
+		t.Errorf("Expected AlreadyExists error creating duplicate EndpointSlice, got %v", err)
+	}
+
+	mutated := slice.DeepCopy()
+	mutated.AddressType = discovery.AddressTypeIPv6
+	if _, err := storage.Update(context.TODO(), namespace, mutated); !errors.IsInvalid(err) {
+		t.Errorf("Expected Invalid error updating AddressType, got %v", err)
+	}
+
+	missing := slice.DeepCopy()
+	missing.Name = "test-ep-missing"
+	if _, err := storage.Update(context.TODO(), namespace, missing); !errors.IsNotFound(err) {
+		t.Errorf("Expected NotFound error updating missing EndpointSlice, got %v", err)
+	}
+
+	oversized := &discovery.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: "test-ep-2", Namespace: namespace},
+		AddressType: discovery.AddressTypeIPv4,
+	}
+	for i := 0; i < maxEndpointsPerSlice+1; i++ {
+		oversized.Endpoints = append(oversized.Endpoints, discovery.Endpoint{
+			Addresses: []string{fmt.Sprintf("10.0.%d.%d", i/256, i%256)},
+		})
+	}
+	if _, err := storage.Create(context.TODO(), namespace, oversized); !errors.IsInvalid(err) {
+		t.Errorf("Expected Invalid error creating oversized EndpointSlice, got %v", err)
+	}
+
+	if err := storage.Delete(context.TODO(), namespace, "test-ep-1"); err != nil {
+		t.Fatalf("Expected no error deleting EndpointSlice, got %v", err)
+	}
+	if err := storage.Delete(context.TODO(), namespace, "test-ep-1"); !errors.IsNotFound(err) {
+		t.Errorf("Expected NotFound error deleting missing EndpointSlice, got %v", err)
+	}
+}
+
+// TestFinalizeWithMemorySliceStorage ensures finalize writes through a
+// configured sliceStorage rather than the API client.
+func TestFinalizeWithMemorySliceStorage(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+	}
+
+	storage := newMemorySliceStorage()
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.sliceStorage = storage
+
+	toCreate := newEndpointSlice(&endpoints, []discovery.EndpointPort{}, discovery.AddressTypeIPv4, "")
+	_, err := r.finalize(context.TODO(), &endpoints, slicesByAction{toCreate: []*discovery.EndpointSlice{toCreate}})
+	if err != nil {
+		t.Fatalf("Expected no error finalizing slices, got %v", err)
+	}
+
+	if len(storage.slices) != 1 {
+		t.Errorf("Expected 1 EndpointSlice in storage, got %d", len(storage.slices))
+	}
+	if len(client.Actions()) != 0 {
+		t.Errorf("Expected no client actions, got %d", len(client.Actions()))
+	}
+}
+
+// TestReconcilePerPortMapReadiness ensures that the same IP can be ready
+// under one port mapping and not ready under another, with deduplication
+// applied per (addressType, portMap, IP).
+func TestReconcilePerPortMapReadiness(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{
+				Name:     "https",
+				Port:     443,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			NotReadyAddresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Endpoints) != 1 {
+			t.Fatalf("Expected 1 endpoint in EndpointSlice %s, got %d", epSlice.Name, len(epSlice.Endpoints))
+		}
+		endpoint := epSlice.Endpoints[0]
+		if endpoint.Addresses[0] != "10.0.0.1" {
+			t.Errorf("Expected endpoint address 10.0.0.1, got %s", endpoint.Addresses[0])
+		}
+
+		expectedReady := *epSlice.Ports[0].Port == 80
+		if *endpoint.Conditions.Ready != expectedReady {
+			t.Errorf("Expected ready to be %t for port %d, got %t", expectedReady, *epSlice.Ports[0].Port, *endpoint.Conditions.Ready)
+		}
+	}
+}
+
+// TestReconcileMaxReadyMaxNotReady ensures that separate caps for ready and
+// not-ready addresses are applied independently, so a flood of not-ready
+// addresses cannot crowd out ready ones.
+func TestReconcileMaxReadyMaxNotReady(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{{
+			Name:     "http",
+			Port:     80,
+			Protocol: corev1.ProtocolTCP,
+		}},
+	}
+	numReady := 5
+	numNotReady := 20
+	for i := 0; i < numReady; i++ {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.0.%d", i+1),
+		})
+	}
+	for i := 0; i < numNotReady; i++ {
+		subset.NotReadyAddresses = append(subset.NotReadyAddresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.1.%d", i+1),
+		})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.maxReady = 10
+	r.maxNotReady = 10
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	readyMirrored := 0
+	notReadyMirrored := 0
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		if *endpoint.Conditions.Ready {
+			readyMirrored++
+		} else {
+			notReadyMirrored++
+		}
+	}
+
+	if readyMirrored != numReady {
+		t.Errorf("Expected all %d ready addresses to be mirrored, got %d", numReady, readyMirrored)
+	}
+	if notReadyMirrored != int(r.maxNotReady) {
+		t.Errorf("Expected %d not-ready addresses to be mirrored, got %d", r.maxNotReady, notReadyMirrored)
+	}
+}
+
+// TestReconcileSlicesUnchangedMetric ensures that the SlicesUnchanged counter
+// increments when an existing EndpointSlice already matches the desired state
+// and that no client calls are made in that case.
+func TestReconcileSlicesUnchangedMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	actualUnchanged, err := testutil.GetCounterMetricValue(metrics.SlicesUnchanged.WithLabelValues())
+	handleErr(t, err, "slicesUnchanged")
+	if actualUnchanged != 0 {
+		t.Errorf("Expected slicesUnchanged to be 0 after initial sync, got %v", actualUnchanged)
+	}
+
+	// Reconcile again with the slice that was just created. Nothing should
+	// change and no client calls should be made.
+	numActions := len(client.Actions())
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+
+	actualUnchanged, err = testutil.GetCounterMetricValue(metrics.SlicesUnchanged.WithLabelValues())
+	handleErr(t, err, "slicesUnchanged")
+	if actualUnchanged != 1 {
+		t.Errorf("Expected slicesUnchanged to be 1 after no-op sync, got %v", actualUnchanged)
+	}
+
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions, got %d", len(client.Actions())-numActions)
+	}
+}
+
+// TestReconcileOwnerRefFlags ensures that configured BlockOwnerDeletion and
+// Controller overrides are applied to the owner reference of generated
+// EndpointSlices.
+func TestReconcileOwnerRefFlags(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.blockOwnerDeletion = pointer.Bool(false)
+	r.ownerController = pointer.Bool(false)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].OwnerReferences) != 1 {
+		t.Fatalf("Expected 1 owner reference, got %d", len(endpointSlices[0].OwnerReferences))
+	}
+
+	ownerRef := endpointSlices[0].OwnerReferences[0]
+	if ownerRef.BlockOwnerDeletion == nil || *ownerRef.BlockOwnerDeletion {
+		t.Errorf("Expected BlockOwnerDeletion to be false, got %v", ownerRef.BlockOwnerDeletion)
+	}
+	if ownerRef.Controller == nil || *ownerRef.Controller {
+		t.Errorf("Expected Controller to be false, got %v", ownerRef.Controller)
+	}
+}
+
+// TestReconcileRejectOverLengthHostname ensures that addresses with hostnames
+// exceeding the maximum length are treated as invalid and not mirrored.
+func TestReconcileRejectOverLengthHostname(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP:       "10.0.0.2",
+				Hostname: strings.Repeat("a", maxAddressHostnameLength+1),
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 1 {
+		t.Fatalf("Expected 1 endpoint, got %d", len(endpointSlices[0].Endpoints))
+	}
+	if endpointSlices[0].Endpoints[0].Addresses[0] != "10.0.0.1" {
+		t.Errorf("Expected endpoint address 10.0.0.1, got %s", endpointSlices[0].Endpoints[0].Addresses[0])
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, InvalidIPAddress) {
+			t.Errorf("Expected %s event, got %s", InvalidIPAddress, event)
+		}
+	default:
+		t.Errorf("Expected %s event, got none", InvalidIPAddress)
+	}
+}
+
+// BenchmarkReconcile measures reconciles that generate a new EndpointSlice.
+func BenchmarkReconcile(b *testing.B) {
+	tCtx := ktesting.Init(b)
+	client := newClientset()
+	setupMetrics()
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{{
+			Name:     "http",
+			Port:     80,
+			Protocol: corev1.ProtocolTCP,
+		}},
+	}
+	for i := 0; i < 250; i++ {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+		})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	// Write through an in-memory storage backend so the benchmark measures
+	// reconcile cost rather than fake clientset bookkeeping.
+	r.sliceStorage = newMemorySliceStorage()
+	logger, _ := ktesting.NewTestContext(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := r.reconcile(logger, &endpoints, nil); err != nil {
+			b.Fatalf("Expected no error reconciling Endpoint Slices, got: %v", err)
+		}
+	}
+}
+
+// TestReconcileStablePrimarySlice ensures that the lexicographically-first
+// slice holds the endpoints with the lowest addresses and keeps its contents
+// across reconciles when churn happens elsewhere.
+func TestReconcileStablePrimarySlice(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	subsets := func(ips ...string) []corev1.EndpointSubset {
+		subset := corev1.EndpointSubset{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+		}
+		for _, ip := range ips {
+			subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: ip})
+		}
+		return []corev1.EndpointSubset{subset}
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep",
+			Namespace: "test",
+			Annotations: map[string]string{
+				targetSlicesAnnotation: "2",
+			},
+		},
+		Subsets: subsets("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"),
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.stablePrimarySlice = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	fetchExisting := func() []*discovery.EndpointSlice {
+		t.Helper()
+		fetchedSlices := fetchEndpointSlices(t, client, "test")
+		existingSlices := []*discovery.EndpointSlice{}
+		for i := range fetchedSlices {
+			existingSlices = append(existingSlices, &fetchedSlices[i])
+		}
+		return existingSlices
+	}
+
+	// The initial creates are assigned generated names, so a second reconcile
+	// is needed to assign the lowest addresses to the first-named slice.
+	reconcileHelper(t, r, &endpoints, fetchExisting())
+
+	primaryAddresses := func() (string, []string) {
+		t.Helper()
+		endpointSlices := fetchEndpointSlices(t, client, "test")
+		if len(endpointSlices) != 2 {
+			t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+		}
+		sort.Slice(endpointSlices, func(i, j int) bool {
+			return endpointSlices[i].Name < endpointSlices[j].Name
+		})
+		addresses := []string{}
+		for _, endpoint := range endpointSlices[0].Endpoints {
+			addresses = append(addresses, endpoint.Addresses[0])
+		}
+		sort.Strings(addresses)
+		return endpointSlices[0].Name, addresses
+	}
+
+	initialName, initialAddresses := primaryAddresses()
+	expectedAddresses := []string{"10.0.0.1", "10.0.0.2"}
+	if !reflect.DeepEqual(initialAddresses, expectedAddresses) {
+		t.Fatalf("Expected primary slice to hold %v, got %v", expectedAddresses, initialAddresses)
+	}
+
+	// Churn an address that sorts after the primary slice's endpoints. The
+	// primary slice's contents should not change.
+	endpoints.Subsets = subsets("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.9.9")
+	reconcileHelper(t, r, &endpoints, fetchExisting())
+
+	churnedName, churnedAddresses := primaryAddresses()
+	if churnedName != initialName {
+		t.Errorf("Expected primary slice name to remain %s, got %s", initialName, churnedName)
+	}
+	if !reflect.DeepEqual(churnedAddresses, initialAddresses) {
+		t.Errorf("Expected primary slice to still hold %v, got %v", initialAddresses, churnedAddresses)
+	}
+}
+
+// TestReconcileSplitPorts ensures that a subset with more distinct ports than
+// an EndpointSlice can hold is partitioned across multiple slices by port.
+func TestReconcileSplitPorts(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	numPorts := 150
+	subset := corev1.EndpointSubset{
+		Addresses: []corev1.EndpointAddress{{
+			IP: "10.0.0.1",
+		}},
+	}
+	for i := 0; i < numPorts; i++ {
+		subset.Ports = append(subset.Ports, corev1.EndpointPort{
+			Name:     fmt.Sprintf("port-%d", i),
+			Port:     int32(8000 + i),
+			Protocol: corev1.ProtocolTCP,
+		})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	totalPorts := 0
+	portNames := map[string]int{}
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Ports) > maxPortsPerSlice {
+			t.Errorf("Expected EndpointSlice %s to hold at most %d ports, got %d", epSlice.Name, maxPortsPerSlice, len(epSlice.Ports))
+		}
+		totalPorts += len(epSlice.Ports)
+		for _, port := range epSlice.Ports {
+			portNames[*port.Name]++
+		}
+		if len(epSlice.Endpoints) != 1 {
+			t.Errorf("Expected 1 endpoint in EndpointSlice %s, got %d", epSlice.Name, len(epSlice.Endpoints))
+		}
+	}
+
+	if totalPorts != numPorts {
+		t.Errorf("Expected %d ports across EndpointSlices, got %d", numPorts, totalPorts)
+	}
+	for name, count := range portNames {
+		if count > 1 {
+			t.Errorf("Expected port %s to appear in a single EndpointSlice, got %d", name, count)
+		}
+	}
+}
+
+// TestReconcileDeprioritizeTerminating ensures that endpoints backed by
+// terminating pods are placed after serving endpoints when endpoints are
+// distributed across multiple slices.
+func TestReconcileDeprioritizeTerminating(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	namespace := "test"
+	deletionTimestamp := metav1.Now()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := 1; i <= 4; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("pod-%d", i),
+				Namespace: namespace,
+			},
+		}
+		if i == 1 {
+			pod.DeletionTimestamp = &deletionTimestamp
+		}
+		if err := indexer.Add(pod); err != nil {
+			t.Fatalf("Expected no error adding Pod, got %v", err)
+		}
+	}
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{{
+			Name:     "http",
+			Port:     80,
+			Protocol: corev1.ProtocolTCP,
+		}},
+	}
+	for i := 1; i <= 4; i++ {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.0.%d", i),
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: namespace,
+				Name:      fmt.Sprintf("pod-%d", i),
+			},
+		})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep",
+			Namespace: namespace,
+			Annotations: map[string]string{
+				targetSlicesAnnotation: "2",
+			},
+		},
+		Subsets: []corev1.EndpointSubset{subset},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.podLister = corelisters.NewPodLister(indexer)
+	r.deprioritizeTerminating = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	var servingSlice, terminatingSlice *discovery.EndpointSlice
+	for i, epSlice := range endpointSlices {
+		holdsTerminating := false
+		for _, endpoint := range epSlice.Endpoints {
+			if endpoint.Addresses[0] == "10.0.0.1" {
+				holdsTerminating = true
+				if endpoint.Conditions.Terminating == nil || !*endpoint.Conditions.Terminating {
+					t.Errorf("Expected endpoint 10.0.0.1 to be marked terminating")
+				}
+			}
+		}
+		if holdsTerminating {
+			terminatingSlice = &endpointSlices[i]
+		} else {
+			servingSlice = &endpointSlices[i]
+		}
+	}
+	if terminatingSlice == nil || servingSlice == nil {
+		t.Fatalf("Expected the terminating endpoint to be isolated to one EndpointSlice")
+	}
+
+	// The serving endpoints with the lowest addresses fill the first slice,
+	// leaving the terminating endpoint in the later slice.
+	servingAddresses := []string{}
+	for _, endpoint := range servingSlice.Endpoints {
+		servingAddresses = append(servingAddresses, endpoint.Addresses[0])
+	}
+	sort.Strings(servingAddresses)
+	if !reflect.DeepEqual(servingAddresses, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("Expected first slice to hold serving endpoints 10.0.0.2 and 10.0.0.3, got %v", servingAddresses)
+	}
+}
+
+// TestFinalizeTransientErrorRequeueDelay ensures that rate-limited failures
+// from the apiserver surface a suggested requeue delay on the returned error.
+func TestFinalizeTransientErrorRequeueDelay(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	retryAfterSeconds := int64(10)
+	client.PrependReactor("create", "endpointslices", k8stesting.ReactionFunc(
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewTooManyRequests("too many requests", int(retryAfterSeconds))
+		}))
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+	}
+	toCreate := newEndpointSlice(&endpoints, []discovery.EndpointPort{}, discovery.AddressTypeIPv4, "")
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	_, err := r.finalize(context.TODO(), &endpoints, slicesByAction{
+		toCreate: []*discovery.EndpointSlice{toCreate},
+	})
+	if err == nil {
+		t.Fatalf("Expected error finalizing slices, got none")
+	}
+
+	delay, ok := suggestedRequeueDelay(err)
+	if !ok {
+		t.Fatalf("Expected a suggested requeue delay on error, got none: %v", err)
+	}
+	if delay != time.Duration(retryAfterSeconds)*time.Second {
+		t.Errorf("Expected suggested requeue delay of %ds, got %v", retryAfterSeconds, delay)
+	}
+}
+
+// TestReconcileContentGeneration ensures that the content generation
+// annotation increments only when the mirrored content of a slice changes.
+func TestReconcileContentGeneration(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.emitContentGeneration = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	fetchGeneration := func() string {
+		t.Helper()
+		endpointSlices := fetchEndpointSlices(t, client, "test")
+		if len(endpointSlices) != 1 {
+			t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+		}
+		if endpointSlices[0].Annotations[contentHashAnnotation] == "" {
+			t.Errorf("Expected content hash annotation to be set")
+		}
+		return endpointSlices[0].Annotations[contentGenerationAnnotation]
+	}
+	fetchExisting := func() []*discovery.EndpointSlice {
+		t.Helper()
+		fetchedSlices := fetchEndpointSlices(t, client, "test")
+		existingSlices := []*discovery.EndpointSlice{}
+		for i := range fetchedSlices {
+			existingSlices = append(existingSlices, &fetchedSlices[i])
+		}
+		return existingSlices
+	}
+
+	if generation := fetchGeneration(); generation != "1" {
+		t.Fatalf("Expected content generation 1 after create, got %s", generation)
+	}
+
+	// A metadata-only change triggers an update but does not change content,
+	// so the generation must not increment.
+	endpoints.Labels = map[string]string{"environment": "canary"}
+	reconcileHelper(t, r, &endpoints, fetchExisting())
+	if generation := fetchGeneration(); generation != "1" {
+		t.Errorf("Expected content generation to stay 1 after metadata-only change, got %s", generation)
+	}
+
+	// A content change must increment the generation.
+	endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{
+		IP: "10.0.0.2",
+	})
+	reconcileHelper(t, r, &endpoints, fetchExisting())
+	if generation := fetchGeneration(); generation != "2" {
+		t.Errorf("Expected content generation 2 after content change, got %s", generation)
+	}
+}
+
+// TestReconcileCanonicalAddresses ensures that non-canonical IP strings are
+// mirrored in canonical form and deduplicate with their canonical
+// equivalents.
+func TestReconcileCanonicalAddresses(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "010.000.000.001",
+			}, {
+				IP: "10.0.0.1",
+			}, {
+				IP: "2001:DB8::0001",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Endpoints) != 1 {
+			t.Fatalf("Expected 1 endpoint in EndpointSlice %s, got %d", epSlice.Name, len(epSlice.Endpoints))
+		}
+		address := epSlice.Endpoints[0].Addresses[0]
+		switch epSlice.AddressType {
+		case discovery.AddressTypeIPv4:
+			if address != "10.0.0.1" {
+				t.Errorf("Expected canonical IPv4 address 10.0.0.1, got %s", address)
+			}
+		case discovery.AddressTypeIPv6:
+			if address != "2001:db8::1" {
+				t.Errorf("Expected canonical IPv6 address 2001:db8::1, got %s", address)
+			}
+		default:
+			t.Errorf("Unexpected address type %s", epSlice.AddressType)
+		}
+	}
+}
+
+// TestReconcileOversizedExistingSlice ensures that an adopted EndpointSlice
+// holding more endpoints than maxEndpointsPerSubset allows is repacked under
+// the limit on the next reconcile.
+func TestReconcileOversizedExistingSlice(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	maxEndpoints := int32(10)
+	protoTCP := corev1.ProtocolTCP
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{{
+			Name:     "http",
+			Port:     80,
+			Protocol: corev1.ProtocolTCP,
+		}},
+	}
+	for i := 0; i < int(maxEndpoints); i++ {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.0.%d", i+1),
+		})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+
+	// An adopted slice holding more endpoints than maxEndpointsPerSubset,
+	// including stale entries beyond the desired addresses.
+	oversizedSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-oversized",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String("http"),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+	}
+	for i := 0; i < 15; i++ {
+		oversizedSlice.Endpoints = append(oversizedSlice.Endpoints, discovery.Endpoint{
+			Addresses:  []string{fmt.Sprintf("10.0.0.%d", i+1)},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		})
+	}
+	if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), oversizedSlice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, maxEndpoints)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{oversizedSlice})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	mirroredAddresses := map[string]bool{}
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Endpoints) > int(maxEndpoints) {
+			t.Errorf("Expected EndpointSlice %s to hold at most %d endpoints, got %d", epSlice.Name, maxEndpoints, len(epSlice.Endpoints))
+		}
+		for _, endpoint := range epSlice.Endpoints {
+			mirroredAddresses[endpoint.Addresses[0]] = true
+		}
+	}
+	if len(mirroredAddresses) != int(maxEndpoints) {
+		t.Errorf("Expected %d desired addresses to be mirrored, got %d", maxEndpoints, len(mirroredAddresses))
+	}
+}
+
+// TestReconcileHashMismatchCanary ensures that a stored content hash that
+// disagrees with a recomputation of unchanged content fires the HashMismatch
+// canary.
+func TestReconcileHashMismatchCanary(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.emitContentGeneration = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, "test")
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	// Reconciling the unchanged slice must not fire the canary.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	actualMismatches, err := testutil.GetCounterMetricValue(metrics.HashMismatches.WithLabelValues())
+	handleErr(t, err, "hashMismatches")
+	if actualMismatches != 0 {
+		t.Errorf("Expected hashMismatches to be 0 for a valid stored hash, got %v", actualMismatches)
+	}
+
+	// Corrupt the stored hash without changing content. The canary must fire
+	// on the next no-op reconcile.
+	corruptedSlice := endpointSlices[0].DeepCopy()
+	corruptedSlice.Annotations[contentHashAnnotation] = "bogus"
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{corruptedSlice})
+
+	actualMismatches, err = testutil.GetCounterMetricValue(metrics.HashMismatches.WithLabelValues())
+	handleErr(t, err, "hashMismatches")
+	if actualMismatches != 1 {
+		t.Errorf("Expected hashMismatches to be 1 for a corrupted stored hash, got %v", actualMismatches)
+	}
+}
+
+// TestReconcilePreferredAddressFamily ensures that slices created for the
+// preferred address family sort before slices for other families.
+func TestReconcilePreferredAddressFamily(t *testing.T) {
+	testCases := []struct {
+		preferredFamily discovery.AddressType
+	}{
+		{preferredFamily: discovery.AddressTypeIPv4},
+		{preferredFamily: discovery.AddressTypeIPv6},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.preferredFamily), func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{
+						Name:     "http",
+						Port:     80,
+						Protocol: corev1.ProtocolTCP,
+					}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}, {
+						IP: "2001:db8::1",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.preferredAddressFamily = tc.preferredFamily
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+			endpointSlices := fetchEndpointSlices(t, client, "test")
+			if len(endpointSlices) != 2 {
+				t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+			}
+			sort.Slice(endpointSlices, func(i, j int) bool {
+				return endpointSlices[i].Name < endpointSlices[j].Name
+			})
+
+			if endpointSlices[0].AddressType != tc.preferredFamily {
+				t.Errorf("Expected first EndpointSlice to be %s, got %s", tc.preferredFamily, endpointSlices[0].AddressType)
+			}
+		})
+	}
+}
+
+// TestReconcileMergesFragmentedSlices ensures that two slices sharing a port
+// mapping but holding complementary address subsets are merged into a single
+// slice when both are under the limit.
+func TestReconcileMergesFragmentedSlices(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{{
+			Name:     "http",
+			Port:     80,
+			Protocol: protoTCP,
+		}},
+		Addresses: []corev1.EndpointAddress{{
+			IP: "10.0.0.1",
+		}, {
+			IP: "10.0.0.2",
+		}},
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+
+	// Two slices with the same port set, each holding half the addresses.
+	existingSlices := []*discovery.EndpointSlice{}
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		epSlice := &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("test-ep-%d", i+1),
+				Namespace: namespace,
+				Labels: map[string]string{
+					discovery.LabelServiceName: endpoints.Name,
+					discovery.LabelManagedBy:   controllerName,
+				},
+			},
+			AddressType: discovery.AddressTypeIPv4,
+			Ports: []discovery.EndpointPort{{
+				Name:     pointer.String("http"),
+				Port:     pointer.Int32(80),
+				Protocol: &protoTCP,
+			}},
+			Endpoints: []discovery.Endpoint{{
+				Addresses:  []string{ip},
+				Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+			}},
+		}
+		if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), epSlice, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+		}
+		existingSlices = append(existingSlices, epSlice)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, existingSlices)
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected fragmented slices to merge into 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	mirroredAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		mirroredAddresses = append(mirroredAddresses, endpoint.Addresses[0])
+	}
+	sort.Strings(mirroredAddresses)
+	if !reflect.DeepEqual(mirroredAddresses, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expected merged slice to hold both addresses, got %v", mirroredAddresses)
+	}
+}
+
+// TestReconcileTruncationAnnotation ensures the truncation annotation is
+// stamped on mirrored slices when addresses were skipped for exceeding
+// MaxEndpointsPerSubset, and absent when everything was mirrored.
+func TestReconcileTruncationAnnotation(t *testing.T) {
+	testCases := []struct {
+		testName              string
+		maxEndpointsPerSubset int32
+		expectAnnotation      bool
+	}{{
+		testName:              "all addresses mirrored",
+		maxEndpointsPerSubset: defaultMaxEndpointsPerSubset,
+		expectAnnotation:      false,
+	}, {
+		testName:              "addresses truncated",
+		maxEndpointsPerSubset: 2,
+		expectAnnotation:      true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}, {
+						IP: "10.0.0.2",
+					}, {
+						IP: "10.0.0.3",
+					}, {
+						IP: "10.0.0.4",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, tc.maxEndpointsPerSubset)
+			r.markTruncation = true
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+			for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+				_, ok := epSlice.Annotations[truncatedAnnotation]
+				if ok != tc.expectAnnotation {
+					t.Errorf("Expected truncation annotation presence to be %t for EndpointSlice %s, got %t", tc.expectAnnotation, epSlice.Name, ok)
+				}
+			}
+		})
+	}
+}
+
+// TestReconcileSubsetAddressCountMetric ensures each Endpoints subset records
+// its address count in the SubsetAddressCount metric.
+func TestReconcileSubsetAddressCountMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}, {
+				IP: "10.0.0.3",
+			}},
+			NotReadyAddresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.4",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.5",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	// The histogram value is the sum of observations: 4 addresses in the
+	// first subset plus 1 in the second.
+	actualCount, err := testutil.GetHistogramMetricValue(metrics.SubsetAddressCount.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Failed to get SubsetAddressCount metric: %v", err)
+	}
+	if actualCount != 5 {
+		t.Errorf("Expected SubsetAddressCount observations to sum to 5, got %v", actualCount)
+	}
+}
+
+// TestReconcileValidatePortsAgainstService ensures a Warning event is emitted
+// for Endpoints ports not declared on the corresponding Service.
+func TestReconcileValidatePortsAgainstService(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Name: "http",
+				Port: 80,
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error adding Service, got %v", err)
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}, {
+				Name:     "stray",
+				Port:     9090,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.serviceLister = corelisters.NewServiceLister(indexer)
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	expectedEvent := fmt.Sprintf("Warning PortNotInService Port %q (9090) is not declared on Service %s/test-ep", "stray", namespace)
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Fatal("Expected a warning event for the stray port, got none")
+	}
+
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Expected no event for the declared port, got %q", event)
+	default:
+	}
+}
+
+// TestDesiredStateJSON ensures the desired endpoint state can be exported as
+// JSON for debugging without touching the cluster.
+func TestDesiredStateJSON(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "http",
+				Port:     80,
+				Protocol: corev1.ProtocolTCP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.2",
+			}, {
+				IP: "10.0.0.1",
+			}},
+			NotReadyAddresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.3",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	logger, _ := ktesting.NewTestContext(t)
+	raw, err := r.desiredStateJSON(logger, &endpoints)
+	if err != nil {
+		t.Fatalf("Expected no error exporting desired state, got %v", err)
+	}
+
+	desired := map[string][]discovery.Endpoint{}
+	if err := json.Unmarshal(raw, &desired); err != nil {
+		t.Fatalf("Expected valid JSON, got error %v", err)
+	}
+	if len(desired) != 1 {
+		t.Fatalf("Expected desired state for 1 port mapping, got %d", len(desired))
+	}
+
+	for _, desiredEndpoints := range desired {
+		expectedAddresses := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+		if len(desiredEndpoints) != len(expectedAddresses) {
+			t.Fatalf("Expected %d desired endpoints, got %d", len(expectedAddresses), len(desiredEndpoints))
+		}
+		for i, endpoint := range desiredEndpoints {
+			if endpoint.Addresses[0] != expectedAddresses[i] {
+				t.Errorf("Expected endpoint %d to have address %s, got %s", i, expectedAddresses[i], endpoint.Addresses[0])
+			}
+		}
+		if *desiredEndpoints[2].Conditions.Ready {
+			t.Errorf("Expected endpoint 10.0.0.3 to not be ready")
+		}
+	}
+
+	if len(client.Actions()) != 0 {
+		t.Errorf("Expected no api calls, got %d", len(client.Actions()))
+	}
+}
+
+// TestReconcilePreserveEndpointOrder ensures that, with endpoint order
+// preservation enabled, adding an address keeps existing endpoints in their
+// positions and appends the new endpoint at the end.
+func TestReconcilePreserveEndpointOrder(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "test-ep",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String(""),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.2"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}, {
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}, {
+				IP: "10.0.0.3",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.preserveEndpointOrder = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	actualAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		actualAddresses = append(actualAddresses, endpoint.Addresses[0])
+	}
+	expectedAddresses := []string{"10.0.0.2", "10.0.0.1", "10.0.0.3"}
+	if !reflect.DeepEqual(actualAddresses, expectedAddresses) {
+		t.Errorf("Expected endpoint order %v, got %v", expectedAddresses, actualAddresses)
+	}
+}
+
+// TestReconcileSyncBudget ensures a reconcile aborts with a requeue hint when
+// its time budget is spent before all writes complete.
+func TestReconcileSyncBudget(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	// Two distinct port mappings produce two slice creates.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 80}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+		}, {
+			Ports:     []corev1.EndpointPort{{Name: "https", Port: 443}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+		}},
+	}
+
+	memStorage := newMemorySliceStorage()
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.sliceStorage = &slowSliceStorage{delegate: memStorage, delay: 100 * time.Millisecond}
+	r.syncBudget = 50 * time.Millisecond
+
+	logger, _ := ktesting.NewTestContext(t)
+	err := r.reconcile(logger, &endpoints, []*discovery.EndpointSlice{})
+	if err == nil {
+		t.Fatal("Expected reconcile to abort when the time budget was spent, got no error")
+	}
+	delay, ok := suggestedRequeueDelay(err)
+	if !ok {
+		t.Fatalf("Expected a requeue hint on budget exceeded, got %v", err)
+	}
+	if delay != defaultRequeueDelay {
+		t.Errorf("Expected requeue delay %v, got %v", defaultRequeueDelay, delay)
+	}
+	if len(memStorage.slices) != 1 {
+		t.Errorf("Expected 1 EndpointSlice written before the budget was spent, got %d", len(memStorage.slices))
+	}
+}
+
+// TestReconcileCustomAddressTypeResolver ensures a custom address type
+// resolver routes addresses to slices of the resolved address type.
+func TestReconcileCustomAddressTypeResolver(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	customType := discovery.AddressType("example.com/custom")
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "vip-1",
+			}, {
+				IP: "vip-2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.addressTypeResolver = func(address corev1.EndpointAddress) *discovery.AddressType {
+		return &customType
+	}
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].AddressType != customType {
+		t.Errorf("Expected address type %s, got %s", customType, endpointSlices[0].AddressType)
+	}
+
+	mirroredAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		mirroredAddresses = append(mirroredAddresses, endpoint.Addresses[0])
+	}
+	sort.Strings(mirroredAddresses)
+	if !reflect.DeepEqual(mirroredAddresses, []string{"vip-1", "vip-2"}) {
+		t.Errorf("Expected addresses [vip-1 vip-2], got %v", mirroredAddresses)
+	}
+}
+
+// TestReconcileChangelog ensures the optional changelog accurately reflects
+// the creates, updates, and deletes performed by each reconcile.
+func TestReconcileChangelog(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.changelog = &sliceChangelog{}
+
+	// First reconcile creates one slice with both endpoints.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+	changes := r.changelog.Changes()
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %d: %v", len(changes), changes)
+	}
+	if changes[0].Action != "create" || changes[0].Endpoints != 2 || changes[0].Slice == "" {
+		t.Errorf("Expected a create of 2 endpoints with a slice name, got %+v", changes[0])
+	}
+
+	// Removing an address updates the slice in place.
+	existingSlices := []*discovery.EndpointSlice{}
+	for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+		existingSlices = append(existingSlices, epSlice.DeepCopy())
+	}
+	endpoints.Subsets[0].Addresses = endpoints.Subsets[0].Addresses[:1]
+	reconcileHelper(t, r, &endpoints, existingSlices)
+	changes = r.changelog.Changes()
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %d: %v", len(changes), changes)
+	}
+	if changes[0].Action != "update" || changes[0].Endpoints != 1 || changes[0].Slice != existingSlices[0].Name {
+		t.Errorf("Expected an update of %s to 1 endpoint, got %+v", existingSlices[0].Name, changes[0])
+	}
+
+	// Removing all addresses deletes the slice.
+	existingSlices = []*discovery.EndpointSlice{}
+	for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+		existingSlices = append(existingSlices, epSlice.DeepCopy())
+	}
+	endpoints.Subsets = []corev1.EndpointSubset{}
+	reconcileHelper(t, r, &endpoints, existingSlices)
+	changes = r.changelog.Changes()
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %d: %v", len(changes), changes)
+	}
+	if changes[0].Action != "delete" || changes[0].Endpoints != 1 || changes[0].Slice != existingSlices[0].Name {
+		t.Errorf("Expected a delete of %s with 1 endpoint, got %+v", existingSlices[0].Name, changes[0])
+	}
+}
+
+// TestReconcileNotReadyHysteresis ensures a ready to not-ready transition is
+// debounced until it persists across the configured number of reconciles.
+func TestReconcileNotReadyHysteresis(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "test-ep",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String(""),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	// The endpoint has flapped to not ready.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+			NotReadyAddresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.notReadyHysteresis = 2
+
+	// The first observation of the transition is deferred, leaving the
+	// mirrored endpoint ready and requeueing the key so the deferred
+	// transition lands even if no further Endpoints events arrive.
+	err := r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{existingSlice})
+	if _, ok := suggestedRequeueDelay(err); !ok {
+		t.Fatalf("Expected a requeue to be suggested while the transition is deferred, got %v", err)
+	}
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if !*endpointSlices[0].Endpoints[0].Conditions.Ready {
+		t.Fatal("Expected first not-ready observation to be deferred")
+	}
+
+	// The second consecutive observation writes the transition.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+	endpointSlices = fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if *endpointSlices[0].Endpoints[0].Conditions.Ready {
+		t.Error("Expected second consecutive not-ready observation to be written")
+	}
+}
+
+// TestReconcileSplitByZone ensures that, with zonal isolation enabled,
+// endpoints are partitioned into a separate slice per topology zone and each
+// slice is labeled with its zone.
+func TestReconcileSplitByZone(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodeZones := map[string]string{"node-1": "zone-a", "node-2": "zone-b"}
+	for nodeName, zone := range nodeZones {
+		err := indexer.Add(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   nodeName,
+				Labels: map[string]string{corev1.LabelTopologyZone: zone},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error adding Node, got %v", err)
+		}
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP:       "10.0.0.1",
+				NodeName: pointer.String("node-1"),
+			}, {
+				IP:       "10.0.0.2",
+				NodeName: pointer.String("node-2"),
+			}, {
+				IP:       "10.0.0.3",
+				NodeName: pointer.String("node-1"),
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.nodeLister = corelisters.NewNodeLister(indexer)
+	r.splitByZone = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 1 EndpointSlice per zone, got %d", len(endpointSlices))
+	}
+
+	addressesByZone := map[string][]string{}
+	for _, epSlice := range endpointSlices {
+		zone, ok := epSlice.Labels[corev1.LabelTopologyZone]
+		if !ok {
+			t.Fatalf("Expected EndpointSlice %s to be labeled with its zone", epSlice.Name)
+		}
+		for _, endpoint := range epSlice.Endpoints {
+			addressesByZone[zone] = append(addressesByZone[zone], endpoint.Addresses[0])
+		}
+	}
+	for zone, addresses := range addressesByZone {
+		sort.Strings(addresses)
+		addressesByZone[zone] = addresses
+	}
+
+	expectedAddressesByZone := map[string][]string{
+		"zone-a": {"10.0.0.1", "10.0.0.3"},
+		"zone-b": {"10.0.0.2"},
+	}
+	if !reflect.DeepEqual(addressesByZone, expectedAddressesByZone) {
+		t.Errorf("Expected addresses by zone %v, got %v", expectedAddressesByZone, addressesByZone)
+	}
+}
+
+// TestReconcileSignificantShrinkWarning ensures a Warning event fires when a
+// single sync shrinks a slice by more than the configured percentage, while
+// the update still proceeds.
+func TestReconcileSignificantShrinkWarning(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "test-ep",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String(""),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+	}
+	for i := 1; i <= 10; i++ {
+		existingSlice.Endpoints = append(existingSlice.Endpoints, discovery.Endpoint{
+			Addresses:  []string{fmt.Sprintf("10.0.0.%d", i)},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		})
+	}
+	if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	// Only 2 of the 10 addresses remain, an 80% shrink.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.maxShrinkPercent = 50
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	expectedEvent := "Warning SignificantShrink EndpointSlice test-ep-1 shrank from 10 to 2 endpoints in a single sync"
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Fatal("Expected a warning event for the shrink, got none")
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 2 {
+		t.Errorf("Expected the update to proceed to 2 endpoints, got %d", len(endpointSlices[0].Endpoints))
+	}
+}
+
+// TestReconcileCustomEndpointComparator ensures a custom comparator controls
+// which endpoint fields count as a change, so hint-only differences do not
+// trigger updates when the comparator ignores hints.
+func TestReconcileCustomEndpointComparator(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "test-ep",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String(""),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+			Hints: &discovery.EndpointHints{
+				ForZones: []discovery.ForZone{{Name: "zone-a"}},
+			},
+		}},
+	}
+	if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.endpointComparator = func(a, b *discovery.Endpoint) bool {
+		aCopy := a.DeepCopy()
+		aCopy.Hints = nil
+		bCopy := b.DeepCopy()
+		bCopy.Hints = nil
+		return endpointsliceutil.EndpointsEqualBeyondHash(aCopy, bCopy)
+	}
+	client.ClearActions()
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	if len(client.Actions()) != 0 {
+		t.Errorf("Expected no api calls for a hint-only difference, got %d: %#v", len(client.Actions()), client.Actions())
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].Endpoints[0].Hints == nil {
+		t.Error("Expected hints to be left in place")
+	}
+}
+
+// TestReconcileDistinctPortMapsMetric ensures the number of distinct port
+// mappings is recorded per reconcile.
+func TestReconcileDistinctPortMapsMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: "test"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 80}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+		}, {
+			Ports:     []corev1.EndpointPort{{Name: "https", Port: 443}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+		}, {
+			Ports:     []corev1.EndpointPort{{Name: "dns", Port: 53}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.3"}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	actualPortMaps, err := testutil.GetHistogramMetricValue(metrics.DistinctPortMaps.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Failed to get DistinctPortMaps metric: %v", err)
+	}
+	if actualPortMaps != 3 {
+		t.Errorf("Expected DistinctPortMaps metric to be 3, got %v", actualPortMaps)
+	}
+}
+
+// TestReconcileNoTargetRefPolicy ensures addresses without a TargetRef are
+// mirrored, skipped, or mirrored with the slice labeled, depending on the
+// configured policy.
+func TestReconcileNoTargetRefPolicy(t *testing.T) {
+	testCases := []struct {
+		testName          string
+		policy            noTargetRefPolicy
+		expectedAddresses []string
+		expectedLabel     bool
+	}{{
+		testName:          "default policy mirrors all addresses",
+		policy:            "",
+		expectedAddresses: []string{"10.0.0.1", "10.0.0.2"},
+		expectedLabel:     false,
+	}, {
+		testName:          "mirror policy mirrors all addresses",
+		policy:            noTargetRefMirror,
+		expectedAddresses: []string{"10.0.0.1", "10.0.0.2"},
+		expectedLabel:     false,
+	}, {
+		testName:          "skip policy omits addresses without a TargetRef",
+		policy:            noTargetRefSkip,
+		expectedAddresses: []string{"10.0.0.1"},
+		expectedLabel:     false,
+	}, {
+		testName:          "label policy mirrors all addresses and labels the slice",
+		policy:            noTargetRefLabel,
+		expectedAddresses: []string{"10.0.0.1", "10.0.0.2"},
+		expectedLabel:     true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+						TargetRef: &corev1.ObjectReference{
+							Kind: "Pod", Namespace: namespace, Name: "pod-1",
+						},
+					}, {
+						IP: "10.0.0.2",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.noTargetRefPolicy = tc.policy
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+			endpointSlices := fetchEndpointSlices(t, client, namespace)
+			if len(endpointSlices) != 1 {
+				t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+			}
+
+			mirroredAddresses := []string{}
+			for _, endpoint := range endpointSlices[0].Endpoints {
+				mirroredAddresses = append(mirroredAddresses, endpoint.Addresses[0])
+			}
+			sort.Strings(mirroredAddresses)
+			if !reflect.DeepEqual(mirroredAddresses, tc.expectedAddresses) {
+				t.Errorf("Expected addresses %v, got %v", tc.expectedAddresses, mirroredAddresses)
+			}
+
+			_, hasLabel := endpointSlices[0].Labels[externalAddressesLabel]
+			if hasLabel != tc.expectedLabel {
+				t.Errorf("Expected %s label presence to be %t, got %t", externalAddressesLabel, tc.expectedLabel, hasLabel)
+			}
+		})
+	}
+}
+
+// TestReconcileIgnoresSliceOwnedByDifferentUID ensures that a slice owned by
+// an Endpoints resource with the same name but a different UID is left for
+// garbage collection rather than deleted or updated by reconcile.
+func TestReconcileIgnoresSliceOwnedByDifferentUID(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep",
+			Namespace: namespace,
+			UID:       "d8f2c1f6-5285-4b3c-b3c1-9b89f9e7ed7a",
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	// This slice was created for a previous incarnation of the Endpoints
+	// resource that was deleted and recreated with a new UID.
+	staleSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Endpoints",
+				Name:       "test-ep",
+				UID:        "fb91e798-1875-4857-b5eb-e2c878157b4d",
+			}},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.2"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), staleSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{staleSlice})
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" || action.GetVerb() == "update" {
+			t.Errorf("Expected no %s actions on EndpointSlices owned by a different UID, got %#v", action.GetVerb(), action)
+		}
+	}
+
+	fetchedSlices := fetchEndpointSlices(t, client, namespace)
+	if len(fetchedSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(fetchedSlices))
+	}
+	for _, epSlice := range fetchedSlices {
+		if epSlice.Name == staleSlice.Name {
+			if !reflect.DeepEqual(epSlice.Endpoints, staleSlice.Endpoints) {
+				t.Errorf("Expected stale EndpointSlice to be untouched, got endpoints %v", epSlice.Endpoints)
+			}
+		} else if epSlice.OwnerReferences[0].UID != endpoints.UID {
+			t.Errorf("Expected new EndpointSlice to be owned by %s, got %s", endpoints.UID, epSlice.OwnerReferences[0].UID)
+		}
+	}
+}
+
+// TestReconcileEndpointsDeletedBeforeReconcile ensures that a reconcile whose
+// parent Endpoints was deleted between enqueue and reconcile cleans up the
+// mirrored slices rather than attempting creates that would fail.
+func TestReconcileEndpointsDeletedBeforeReconcile(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.2"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+	numInitialActions := len(client.Actions())
+
+	// An empty lister simulates the Endpoints resource being deleted between
+	// enqueue and reconcile.
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.endpointsLister = corelisters.NewEndpointsLister(indexer)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	for _, action := range client.Actions()[numInitialActions:] {
+		if action.GetVerb() == "create" && action.GetResource().Resource == "endpointslices" {
+			t.Errorf("Expected no EndpointSlice creates after parent Endpoints deletion, got %#v", action)
+		}
+	}
+
+	fetchedSlices := fetchEndpointSlices(t, client, namespace)
+	if len(fetchedSlices) != 0 {
+		t.Errorf("Expected mirrored EndpointSlices to be cleaned up, got %d", len(fetchedSlices))
+	}
+}
+
+// TestReconcileSlicesRecycledMetric ensures the SlicesRecycled metric counts
+// create/delete pairs converted to updates by recycleSlices.
+func TestReconcileSlicesRecycledMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// The existing slice has a stale port mapping, so reconcile would delete
+	// it and create a slice with the desired ports. recycleSlices converts the
+	// pair into a single update.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	actualRecycled, err := testutil.GetCounterMetricValue(metrics.SlicesRecycled.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Failed to get SlicesRecycled metric: %v", err)
+	}
+	if actualRecycled != 1 {
+		t.Errorf("Expected SlicesRecycled metric to be 1, got %v", actualRecycled)
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].Name != existingSlice.Name {
+		t.Errorf("Expected existing EndpointSlice %s to be recycled, got %s", existingSlice.Name, endpointSlices[0].Name)
+	}
+	if *endpointSlices[0].Ports[0].Port != 443 {
+		t.Errorf("Expected recycled EndpointSlice to have port 443, got %d", *endpointSlices[0].Ports[0].Port)
+	}
+}
+
+// TestReconcileContentHashAnnotation ensures the content hash annotation is
+// stamped on generated slices and is stable across no-op reconciles.
+func TestReconcileContentHashAnnotation(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.annotateContentHash = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	contentHash := endpointSlices[0].Annotations[contentHashAnnotation]
+	if contentHash == "" {
+		t.Fatal("Expected content hash annotation to be set")
+	}
+	if _, ok := endpointSlices[0].Annotations[contentGenerationAnnotation]; ok {
+		t.Errorf("Expected content generation annotation to be unset, got %s", endpointSlices[0].Annotations[contentGenerationAnnotation])
+	}
+	numActions := len(client.Actions())
+
+	// A second reconcile with unchanged content is a no-op and keeps the same
+	// hash.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions, got %#v", client.Actions()[numActions:])
+	}
+
+	endpointSlices = fetchEndpointSlices(t, client, namespace)
+	if endpointSlices[0].Annotations[contentHashAnnotation] != contentHash {
+		t.Errorf("Expected content hash to remain %s, got %s", contentHash, endpointSlices[0].Annotations[contentHashAnnotation])
+	}
+}
+
+// TestReconcileSCTPMultihoming ensures addresses sharing a TargetRef under an
+// SCTP port mapping fold into a single multihomed endpoint.
+func TestReconcileSCTPMultihoming(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoSCTP := corev1.ProtocolSCTP
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "sctp",
+				Port:     7777,
+				Protocol: protoSCTP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+				TargetRef: &corev1.ObjectReference{
+					Kind: "Pod", Namespace: namespace, Name: "pod-1",
+				},
+			}, {
+				IP: "10.0.0.2",
+				TargetRef: &corev1.ObjectReference{
+					Kind: "Pod", Namespace: namespace, Name: "pod-1",
+				},
+			}, {
+				IP: "10.0.0.3",
+				TargetRef: &corev1.ObjectReference{
+					Kind: "Pod", Namespace: namespace, Name: "pod-2",
+				},
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.sctpMultihoming = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 2 {
+		t.Fatalf("Expected 2 endpoints, got %d", len(endpointSlices[0].Endpoints))
+	}
+
+	addressesByPod := map[string][]string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		addresses := append([]string{}, endpoint.Addresses...)
+		sort.Strings(addresses)
+		addressesByPod[endpoint.TargetRef.Name] = addresses
+	}
+	expected := map[string][]string{
+		"pod-1": {"10.0.0.1", "10.0.0.2"},
+		"pod-2": {"10.0.0.3"},
+	}
+	if !reflect.DeepEqual(addressesByPod, expected) {
+		t.Errorf("Expected multihomed addresses %v, got %v", expected, addressesByPod)
+	}
+}
+
+// TestReconcileServiceLabelAllowlist ensures only allowlisted Service labels
+// are propagated onto generated slices and that propagation does not cause
+// churn on subsequent reconciles.
+func TestReconcileServiceLabelAllowlist(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      endpoints.Name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":  "db",
+				"env":  "prod",
+				"team": "storage",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error adding Service to indexer, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.serviceLister = corelisters.NewServiceLister(indexer)
+	r.serviceLabelAllowlist = []string{"app", "env"}
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].Labels["app"] != "db" || endpointSlices[0].Labels["env"] != "prod" {
+		t.Errorf("Expected allowlisted Service labels to be propagated, got %v", endpointSlices[0].Labels)
+	}
+	if _, ok := endpointSlices[0].Labels["team"]; ok {
+		t.Errorf("Expected label team to not be propagated, got %v", endpointSlices[0].Labels)
+	}
+	numActions := len(client.Actions())
+
+	// A second reconcile with unchanged content is a no-op despite the extra
+	// labels on the slice.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions, got %#v", client.Actions()[numActions:])
+	}
+}
+
+// TestReconcileResourceVersionToken ensures a reconcile replayed against an
+// Endpoints resource version that was already mirrored skips writes, while a
+// new resource version is written and stamped.
+func TestReconcileResourceVersionToken(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace, ResourceVersion: "100"},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.stampResourceVersion = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].Annotations[mirroredResourceVersionAnnotation] != "100" {
+		t.Errorf("Expected mirrored resource version annotation to be 100, got %s", endpointSlices[0].Annotations[mirroredResourceVersionAnnotation])
+	}
+	numActions := len(client.Actions())
+
+	// A replayed sync of the same resource version skips the write even
+	// though the subsets differ.
+	endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: "10.0.0.2"})
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions for a replayed resource version, got %#v", client.Actions()[numActions:])
+	}
+
+	// A new resource version is mirrored and stamped.
+	endpoints.ResourceVersion = "101"
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	endpointSlices = fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 2 {
+		t.Errorf("Expected 2 endpoints after mirroring new resource version, got %d", len(endpointSlices[0].Endpoints))
+	}
+	if endpointSlices[0].Annotations[mirroredResourceVersionAnnotation] != "101" {
+		t.Errorf("Expected mirrored resource version annotation to be 101, got %s", endpointSlices[0].Annotations[mirroredResourceVersionAnnotation])
+	}
+}
+
+// TestReconcileEmptyIPAddress ensures an address with an empty IP is skipped
+// with its own event rather than being reported as a generic invalid IP.
+func TestReconcileEmptyIPAddress(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	expectedEvent := "Warning EmptyIPAddress Skipped 1 addresses with an empty IP when mirroring to EndpointSlices"
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Fatal("Expected a warning event for the empty IP, got none")
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 1 {
+		t.Errorf("Expected 1 endpoint, got %d", len(endpointSlices[0].Endpoints))
+	}
+}
+
+// TestRateLimitedSliceStorage ensures the per-namespace rate limiter throttles
+// writes in one namespace without affecting writes in another.
+func TestRateLimitedSliceStorage(t *testing.T) {
+	// Allow 1 write per second with a burst of 2 per namespace.
+	storage := &rateLimitedSliceStorage{
+		delegate: newMemorySliceStorage(),
+		limiter:  newNamespaceRateLimiter(1, 2),
+	}
+
+	newSlice := func(name string) *discovery.EndpointSlice {
+		return &discovery.EndpointSlice{
+			ObjectMeta:  metav1.ObjectMeta{Name: name},
+			AddressType: discovery.AddressTypeIPv4,
+		}
+	}
+
+	// The first two writes in a namespace consume the burst without blocking.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		_, err := storage.Create(ctx, "ns-a", newSlice(fmt.Sprintf("slice-%d", i)))
+		cancel()
+		if err != nil {
+			t.Fatalf("Expected no error creating EndpointSlice within burst, got %v", err)
+		}
+	}
+
+	// The third write in the same namespace is throttled beyond the context
+	// deadline.
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	_, err := storage.Create(ctx, "ns-a", newSlice("slice-2"))
+	cancel()
+	if err == nil {
+		t.Error("Expected throttled create in ns-a to fail, got no error")
+	}
+
+	// Writes in another namespace are unaffected.
+	ctx, cancel = context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	_, err = storage.Create(ctx, "ns-b", newSlice("slice-0"))
+	cancel()
+	if err != nil {
+		t.Errorf("Expected no error creating EndpointSlice in ns-b, got %v", err)
+	}
+}
+
+// TestReconcileDeterministicEndpointOrder ensures generated slices list
+// endpoints in a deterministic order and that repeated reconciles of the same
+// content are no-ops.
+func TestReconcileDeterministicEndpointOrder(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	addresses := []corev1.EndpointAddress{}
+	for i := 1; i <= 6; i++ {
+		addresses = append(addresses, corev1.EndpointAddress{IP: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports:     []corev1.EndpointPort{{Port: 80}},
+			Addresses: addresses,
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	mirroredAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		mirroredAddresses = append(mirroredAddresses, endpoint.Addresses[0])
+	}
+	expectedAddresses := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	if !reflect.DeepEqual(mirroredAddresses, expectedAddresses) {
+		t.Errorf("Expected endpoints in order %v, got %v", expectedAddresses, mirroredAddresses)
+	}
+	numActions := len(client.Actions())
+
+	// A second reconcile of the same content is a no-op.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions, got %#v", client.Actions()[numActions:])
+	}
+}
+
+// TestReconcileMaxSubsets ensures only the first maxSubsets subsets are
+// mirrored and a warning is recorded for the remainder.
+func TestReconcileMaxSubsets(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports:     []corev1.EndpointPort{{Name: "a", Port: 80}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+		}, {
+			Ports:     []corev1.EndpointPort{{Name: "b", Port: 443}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+		}, {
+			Ports:     []corev1.EndpointPort{{Name: "c", Port: 8080}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.3"}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.maxSubsets = 2
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 2 {
+		t.Errorf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	expectedEvent := "Warning TooManySubsets Only the first 2 of 3 subsets were mirrored to EndpointSlices"
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Fatal("Expected a warning event for the dropped subsets, got none")
+	}
+}
+
+// TestReconcilePortNameConflict ensures a named port mapping to different
+// numbers across subsets is detected, reported, and resolved to the lowest
+// number.
+func TestReconcilePortNameConflict(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 80}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+		}, {
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 8080}},
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.detectPortNameConflicts = true
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	expectedEvent := `Warning PortNameConflict Port name "http" maps to conflicting numbers across subsets; using 80, ignoring [8080]`
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Fatal("Expected a warning event for the port name conflict, got none")
+	}
+
+	// Both subsets resolve to the same port mapping, so all addresses land in
+	// one slice using the winning number.
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Ports) != 1 || *endpointSlices[0].Ports[0].Port != 80 {
+		t.Errorf("Expected a single port 80, got %v", endpointSlices[0].Ports)
+	}
+	if len(endpointSlices[0].Endpoints) != 2 {
+		t.Errorf("Expected 2 endpoints, got %d", len(endpointSlices[0].Endpoints))
+	}
+}
+
+// TestReconcileIndeterminateAddressPolicy ensures that an address whose type
+// cannot be determined is skipped by default and fails the reconcile when
+// failOnIndeterminateAddress is set.
+func TestReconcileIndeterminateAddressPolicy(t *testing.T) {
+	testCases := []struct {
+		testCase                   string
+		failOnIndeterminateAddress bool
+		expectError                bool
+		expectedSlices             int
+	}{{
+		testCase:                   "skip by default",
+		failOnIndeterminateAddress: false,
+		expectError:                false,
+		expectedSlices:             1,
+	}, {
+		testCase:                   "fail when configured",
+		failOnIndeterminateAddress: true,
+		expectError:                true,
+		expectedSlices:             0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}, {
+						IP: "not-an-ip",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.failOnIndeterminateAddress = tc.failOnIndeterminateAddress
+			err := r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{})
+			if tc.expectError && err == nil {
+				t.Fatal("Expected reconcile to fail for the indeterminate address, got no error")
+			}
+			if !tc.expectError && err != nil {
+				t.Fatalf("Expected no error from reconcile, got %v", err)
+			}
+
+			endpointSlices := fetchEndpointSlices(t, client, namespace)
+			if len(endpointSlices) != tc.expectedSlices {
+				t.Fatalf("Expected %d EndpointSlices, got %d", tc.expectedSlices, len(endpointSlices))
+			}
+			if tc.expectedSlices == 1 && len(endpointSlices[0].Endpoints) != 1 {
+				t.Errorf("Expected 1 endpoint, got %d", len(endpointSlices[0].Endpoints))
+			}
+		})
+	}
+}
+
+// TestReconcileEndpointsPerAddressTypeMetric ensures that mirroring dual-stack
+// Endpoints records one observation per address type with the number of
+// desired endpoints of that type.
+func TestReconcileEndpointsPerAddressTypeMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}, {
+				IP: "2001:db8::1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	expectedByAddrType := map[discovery.AddressType]float64{
+		discovery.AddressTypeIPv4: 2,
+		discovery.AddressTypeIPv6: 1,
+	}
+	for addrType, expected := range expectedByAddrType {
+		actual, err := testutil.GetHistogramMetricValue(metrics.EndpointsPerAddressType.WithLabelValues(string(addrType)))
+		if err != nil {
+			t.Fatalf("Error getting EndpointsPerAddressType for %s: %v", addrType, err)
+		}
+		if actual != expected {
+			t.Errorf("Expected EndpointsPerAddressType for %s to be %v, got %v", addrType, expected, actual)
+		}
+	}
+}
+
+// TestReconcileDeferredSliceDeletion ensures that with deferSliceDeletion set,
+// an undesired slice is first marked with the pending-delete annotation and is
+// only deleted if still undesired on the next reconcile, so a transiently
+// stale view of the desired state does not delete a slice prematurely.
+func TestReconcileDeferredSliceDeletion(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	portNum := int32(80)
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: portNum}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.deferSliceDeletion = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	// A stale duplicate slice for the same port mapping, e.g. left behind by
+	// an interrupted sync, is undesired: the desired endpoints are merged into
+	// a single slice. The name sorts after the generated one so the generated
+	// slice is the one that is kept.
+	staleSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "zzz-stale-dup",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports:       []discovery.EndpointPort{{Port: &portNum}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses: []string{"10.0.0.2"},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(tCtx, staleSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating stale EndpointSlice, got %v", err)
+	}
+
+	existingSlices := func() []*discovery.EndpointSlice {
+		fetched := fetchEndpointSlices(t, client, namespace)
+		existing := make([]*discovery.EndpointSlice, 0, len(fetched))
+		for i := range fetched {
+			existing = append(existing, &fetched[i])
+		}
+		return existing
+	}
+	fetchStaleSlice := func() *discovery.EndpointSlice {
+		for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+			if epSlice.Name == staleSlice.Name {
+				return &epSlice
+			}
+		}
+		return nil
+	}
+
+	// The first reconcile that finds the slice undesired only marks it, and
+	// suggests a requeue so the deferred deletion is carried out.
+	err = r.reconcile(tCtx.Logger(), &endpoints, existingSlices())
+	if _, ok := suggestedRequeueDelay(err); !ok {
+		t.Fatalf("Expected a requeue to be suggested while the deletion is deferred, got %v", err)
+	}
+	marked := fetchStaleSlice()
+	if marked == nil {
+		t.Fatal("Expected the stale EndpointSlice to survive the reconcile that found it undesired")
+	}
+	if marked.Annotations[pendingDeleteAnnotation] == "" {
+		t.Errorf("Expected the stale EndpointSlice to be marked with %s", pendingDeleteAnnotation)
+	}
+
+	// The next reconcile finds the slice undesired and already marked, and
+	// deletes it.
+	reconcileHelper(t, r, &endpoints, existingSlices())
+	if fetchStaleSlice() != nil {
+		t.Errorf("Expected the stale EndpointSlice to be deleted once marked and still undesired")
+	}
+	if numSlices := len(fetchEndpointSlices(t, client, namespace)); numSlices != 1 {
+		t.Errorf("Expected 1 EndpointSlice to remain, got %d", numSlices)
+	}
+}
+
+// TestReconcileCrossFamilyAddresses ensures an IPv4 address that also appears
+// in its IPv4-mapped IPv6 form is detected and counted.
+func TestReconcileCrossFamilyAddresses(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "::ffff:10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	actualObservations, err := testutil.GetCounterMetricValue(metrics.CrossFamilyAddresses.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Error getting CrossFamilyAddresses: %v", err)
+	}
+	if actualObservations != 1 {
+		t.Errorf("Expected 1 cross-family address observation, got %v", actualObservations)
+	}
+
+	// Both forms canonicalize to the same endpoint.
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 2 {
+		t.Errorf("Expected 2 endpoints, got %d", len(endpointSlices[0].Endpoints))
+	}
+}
+
+// TestReconcileStableIdentifier ensures the stable identifier annotation is
+// stamped on generated slices and keeps its value when a slice is deleted and
+// recreated.
+func TestReconcileStableIdentifier(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.stampStableIdentifier = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	identifier := endpointSlices[0].Annotations[stableIdentifierAnnotation]
+	if identifier == "" {
+		t.Fatalf("Expected a %s annotation, got none", stableIdentifierAnnotation)
+	}
+
+	// Deleting the slice and mirroring again produces a new slice with a new
+	// name but the same identifier.
+	err := client.DiscoveryV1().EndpointSlices(namespace).Delete(tCtx, endpointSlices[0].Name, metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error deleting EndpointSlice, got %v", err)
+	}
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	recreatedSlices := fetchEndpointSlices(t, client, namespace)
+	if len(recreatedSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(recreatedSlices))
+	}
+	if recreatedSlices[0].Name == endpointSlices[0].Name {
+		t.Errorf("Expected the recreated EndpointSlice to have a new name")
+	}
+	if recreated := recreatedSlices[0].Annotations[stableIdentifierAnnotation]; recreated != identifier {
+		t.Errorf("Expected stable identifier %s on the recreated EndpointSlice, got %s", identifier, recreated)
+	}
+}
+
+// TestReconcileMaxChangesPerSync ensures a large change converges gradually
+// when the number of endpoint changes per sync is capped.
+func TestReconcileMaxChangesPerSync(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.maxChangesPerSync = 3
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	// Replace the single address with 6 new ones: 6 additions plus 1 removal.
+	desiredAddresses := []string{"10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.1.4", "10.0.1.5", "10.0.1.6"}
+	endpoints.Subsets[0].Addresses = nil
+	for _, address := range desiredAddresses {
+		endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: address})
+	}
+
+	existingSlices := func() []*discovery.EndpointSlice {
+		fetched := fetchEndpointSlices(t, client, namespace)
+		existing := make([]*discovery.EndpointSlice, 0, len(fetched))
+		for i := range fetched {
+			existing = append(existing, &fetched[i])
+		}
+		return existing
+	}
+	numEndpoints := func() int {
+		endpointSlices := fetchEndpointSlices(t, client, namespace)
+		if len(endpointSlices) != 1 {
+			t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+		}
+		return len(endpointSlices[0].Endpoints)
+	}
+
+	// Each sync applies at most 3 changes: 3 additions, then the remaining 3
+	// additions, then the removal. Syncs that still defer changes suggest a
+	// requeue; the one that converges does not.
+	for i, expected := range []int{4, 7, 6} {
+		err := r.reconcile(tCtx.Logger(), &endpoints, existingSlices())
+		if _, ok := suggestedRequeueDelay(err); i < 2 && !ok {
+			t.Fatalf("Expected a requeue to be suggested while changes are deferred, got %v", err)
+		}
+		if i == 2 && err != nil {
+			t.Fatalf("Expected no error once the slice converged, got %v", err)
+		}
+		if actual := numEndpoints(); actual != expected {
+			t.Errorf("Expected %d endpoints after sync %d, got %d", expected, i+1, actual)
+		}
+	}
+
+	// The slice has converged on the desired addresses.
+	actualAddresses := []string{}
+	for _, endpoint := range fetchEndpointSlices(t, client, namespace)[0].Endpoints {
+		actualAddresses = append(actualAddresses, endpoint.Addresses...)
+	}
+	sort.Strings(actualAddresses)
+	if !reflect.DeepEqual(desiredAddresses, actualAddresses) {
+		t.Errorf("Expected addresses %v, got %v", desiredAddresses, actualAddresses)
+	}
+
+	// A further reconcile is a no-op.
+	converged := existingSlices()
+	numActions := len(client.Actions())
+	reconcileHelper(t, r, &endpoints, converged)
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions after convergence, got %#v", client.Actions()[numActions:])
+	}
+}
+
+// TestReconcilePortComparatorAppProtocol ensures that adding an appProtocol to
+// an Endpoints port updates the mirrored slice by default, and is ignored when
+// the port comparator excludes appProtocol from port equality.
+func TestReconcilePortComparatorAppProtocol(t *testing.T) {
+	testCases := []struct {
+		testCase            string
+		portComparator      *portComparator
+		expectUpdate        bool
+		expectedAppProtocol *string
+	}{{
+		testCase:            "appProtocol included by default",
+		portComparator:      nil,
+		expectUpdate:        true,
+		expectedAppProtocol: pointer.String("http"),
+	}, {
+		testCase:            "appProtocol excluded",
+		portComparator:      &portComparator{ignoreAppProtocol: true},
+		expectUpdate:        false,
+		expectedAppProtocol: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.portComparator = tc.portComparator
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+			endpointSlices := fetchEndpointSlices(t, client, namespace)
+			if len(endpointSlices) != 1 {
+				t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+			}
+			numActions := len(client.Actions())
+
+			// Add an appProtocol to the Endpoints port and reconcile again.
+			endpoints.Subsets[0].Ports[0].AppProtocol = pointer.String("http")
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+
+			if tc.expectUpdate && len(client.Actions()) == numActions {
+				t.Errorf("Expected the appProtocol change to update the EndpointSlice, got no client actions")
+			}
+			if !tc.expectUpdate && len(client.Actions()) != numActions {
+				t.Errorf("Expected no client actions for an ignored appProtocol change, got %#v", client.Actions()[numActions:])
+			}
+
+			endpointSlices = fetchEndpointSlices(t, client, namespace)
+			if len(endpointSlices) != 1 {
+				t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+			}
+			actualAppProtocol := endpointSlices[0].Ports[0].AppProtocol
+			if !reflect.DeepEqual(tc.expectedAppProtocol, actualAppProtocol) {
+				t.Errorf("Expected appProtocol %v, got %v", tc.expectedAppProtocol, actualAppProtocol)
+			}
+		})
+	}
+}
+
+// TestReconcileDebugSlicePlan ensures the debug option emits a single Normal
+// event per reconcile listing the planned slice actions by name.
+func TestReconcileDebugSlicePlan(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.debugSlicePlan = true
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	nextEvent := func() string {
+		t.Helper()
+		select {
+		case event := <-recorder.Events:
+			return event
+		default:
+			t.Fatal("Expected a SlicePlan event, got none")
+			return ""
+		}
+	}
+
+	// The initial reconcile plans one create; the slice is not named yet so
+	// the plan lists its generate-name prefix.
+	event := nextEvent()
+	if !strings.Contains(event, "Normal SlicePlan") || !strings.Contains(event, "create [") {
+		t.Errorf("Expected a SlicePlan event planning a create, got %q", event)
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	// A reconcile that changes the slice plans an update listing its name.
+	endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: "10.0.0.2"})
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+
+	event = nextEvent()
+	expected := fmt.Sprintf("Normal SlicePlan Planned EndpointSlice actions: create [], update [%s], delete []", endpointSlices[0].Name)
+	if event != expected {
+		t.Errorf("Expected event %q, got %q", expected, event)
+	}
+}
+
+// TestReconcileAdoptUnmanaged ensures a slice without a managed-by label is
+// adopted by relabeling it when adoptUnmanaged is set, and ignored otherwise.
+func TestReconcileAdoptUnmanaged(t *testing.T) {
+	testCases := []struct {
+		testCase       string
+		adoptUnmanaged bool
+	}{{
+		testCase:       "adopt",
+		adoptUnmanaged: true,
+	}, {
+		testCase:       "ignore",
+		adoptUnmanaged: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+			portNum := int32(80)
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: portNum}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}},
+				}},
+			}
+
+			// A legacy slice with matching content but no managed-by label.
+			unmanagedSlice := &discovery.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-ep-legacy",
+					Namespace: namespace,
+				},
+				AddressType: discovery.AddressTypeIPv4,
+				Ports:       []discovery.EndpointPort{{Port: &portNum}},
+				Endpoints: []discovery.Endpoint{{
+					Addresses:  []string{"10.0.0.1"},
+					Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+				}},
+			}
+			_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(tCtx, unmanagedSlice, metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.adoptUnmanaged = tc.adoptUnmanaged
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{unmanagedSlice})
+
+			fetched, err := client.DiscoveryV1().EndpointSlices(namespace).List(tCtx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error listing EndpointSlices, got %v", err)
+			}
+
+			if tc.adoptUnmanaged {
+				// The legacy slice is relabeled in place; no new slice is
+				// created.
+				if len(fetched.Items) != 1 {
+					t.Fatalf("Expected 1 EndpointSlice, got %d", len(fetched.Items))
+				}
+				if fetched.Items[0].Name != unmanagedSlice.Name {
+					t.Errorf("Expected the legacy EndpointSlice to be kept, got %s", fetched.Items[0].Name)
+				}
+				if managedBy := fetched.Items[0].Labels[discovery.LabelManagedBy]; managedBy != controllerName {
+					t.Errorf("Expected managed-by label %s, got %q", controllerName, managedBy)
+				}
+			} else {
+				// The legacy slice is left alone and a new managed slice is
+				// created alongside it.
+				if len(fetched.Items) != 2 {
+					t.Fatalf("Expected 2 EndpointSlices, got %d", len(fetched.Items))
+				}
+				for _, epSlice := range fetched.Items {
+					if epSlice.Name == unmanagedSlice.Name && epSlice.Labels[discovery.LabelManagedBy] != "" {
+						t.Errorf("Expected the legacy EndpointSlice to be left unlabeled")
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestReconcileEndpointWeights ensures per-endpoint weights encoded in the
+// Endpoints weights annotation round-trip onto mirrored slices and that a
+// weight change triggers an update.
+func TestReconcileEndpointWeights(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep",
+			Namespace: namespace,
+			Annotations: map[string]string{
+				endpointWeightsAnnotation: `{"10.0.0.1":5,"10.0.0.2":1}`,
+			},
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	expectedWeights := `{"10.0.0.1":5,"10.0.0.2":1}`
+	if actual := endpointSlices[0].Annotations[endpointWeightsAnnotation]; actual != expectedWeights {
+		t.Errorf("Expected weights annotation %s, got %s", expectedWeights, actual)
+	}
+
+	// A reconcile with unchanged weights is a no-op.
+	numActions := len(client.Actions())
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no additional client actions for unchanged weights, got %#v", client.Actions()[numActions:])
+	}
+
+	// Changing a weight updates the slice.
+	endpoints.Annotations[endpointWeightsAnnotation] = `{"10.0.0.1":3,"10.0.0.2":1}`
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+
+	endpointSlices = fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	expectedWeights = `{"10.0.0.1":3,"10.0.0.2":1}`
+	if actual := endpointSlices[0].Annotations[endpointWeightsAnnotation]; actual != expectedWeights {
+		t.Errorf("Expected weights annotation %s, got %s", expectedWeights, actual)
+	}
+}
+
+// TestReconcileEventBudget ensures that events beyond the per-reconcile budget
+// are dropped and reported by a single summary event.
+func TestReconcileEventBudget(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// Five conflicting port names produce five PortNameConflict events.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{
+				{Name: "a", Port: 80},
+				{Name: "b", Port: 81},
+				{Name: "c", Port: 82},
+				{Name: "d", Port: 83},
+				{Name: "e", Port: 84},
+			},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{
+				{Name: "a", Port: 8080},
+				{Name: "b", Port: 8081},
+				{Name: "c", Port: 8082},
+				{Name: "d", Port: 8083},
+				{Name: "e", Port: 8084},
+			},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.detectPortNameConflicts = true
+	r.maxEventsPerSync = 2
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	events := []string{}
+	for done := false; !done; {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			done = true
+		}
+	}
+
+	// Two events fit the budget; the three remaining conflicts are suppressed
+	// and reported by the summary event.
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d: %v", len(events), events)
+	}
+	for _, event := range events[:2] {
+		if !strings.Contains(event, "Warning PortNameConflict") {
+			t.Errorf("Expected a PortNameConflict event within the budget, got %q", event)
+		}
+	}
+	expectedSummary := "Warning EventBudgetExceeded Suppressed 3 events beyond the budget of 2 for this sync"
+	if events[2] != expectedSummary {
+		t.Errorf("Expected summary event %q, got %q", expectedSummary, events[2])
+	}
+}
+
+// TestReconcileRepairsServiceNameLabel ensures an owned slice whose
+// service-name label does not match the Endpoints name is repaired via update
+// even when its content already matches the desired state.
+func TestReconcileRepairsServiceNameLabel(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	portNum := int32(80)
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: portNum}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	// A slice with matching content but a stale service-name label, e.g. left
+	// behind by a rename of the Endpoints resource.
+	mismatchedSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-stale",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "old-name",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports:       []discovery.EndpointPort{{Port: &portNum}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(tCtx, mismatchedSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+	numActions := len(client.Actions())
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{mismatchedSlice})
+
+	actions := client.Actions()[numActions:]
+	if len(actions) != 1 || !actions[0].Matches("update", "endpointslices") {
+		t.Fatalf("Expected 1 update action, got %#v", actions)
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].Name != mismatchedSlice.Name {
+		t.Errorf("Expected the existing EndpointSlice to be repaired in place, got %s", endpointSlices[0].Name)
+	}
+	if serviceName := endpointSlices[0].Labels[discovery.LabelServiceName]; serviceName != endpoints.Name {
+		t.Errorf("Expected service-name label %s, got %q", endpoints.Name, serviceName)
+	}
+}
+
+// TestReconcileContentOnlyUpdates ensures that a change confined to mirrored
+// annotations updates the slice by default and is skipped under the
+// content-only update policy.
+func TestReconcileContentOnlyUpdates(t *testing.T) {
+	testCases := []struct {
+		testCase           string
+		contentOnlyUpdates bool
+		expectUpdate       bool
+	}{{
+		testCase:           "mirrored by default",
+		contentOnlyUpdates: false,
+		expectUpdate:       true,
+	}, {
+		testCase:           "skipped under content-only policy",
+		contentOnlyUpdates: true,
+		expectUpdate:       false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.contentOnlyUpdates = tc.contentOnlyUpdates
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+			endpointSlices := fetchEndpointSlices(t, client, namespace)
+			if len(endpointSlices) != 1 {
+				t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+			}
+			numActions := len(client.Actions())
+
+			// Add a cosmetic annotation that leaves the content unchanged.
+			endpoints.Annotations = map[string]string{"example.com/team": "blue"}
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+
+			if tc.expectUpdate && len(client.Actions()) == numActions {
+				t.Errorf("Expected the annotation change to update the EndpointSlice, got no client actions")
+			}
+			if !tc.expectUpdate && len(client.Actions()) != numActions {
+				t.Errorf("Expected no client actions under the content-only policy, got %#v", client.Actions()[numActions:])
+			}
+
+			endpointSlices = fetchEndpointSlices(t, client, namespace)
+			if len(endpointSlices) != 1 {
+				t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+			}
+			annotated := endpointSlices[0].Annotations["example.com/team"] == "blue"
+			if tc.expectUpdate && !annotated {
+				t.Errorf("Expected the annotation to be mirrored onto the EndpointSlice")
+			}
+			if !tc.expectUpdate && annotated {
+				t.Errorf("Expected the annotation not to be mirrored under the content-only policy")
+			}
+		})
+	}
+}
+
+func TestReconcileSliceTopologyView(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Name: "http", Port: 80}, {Name: "https", Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "2001:db8::1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{Name: "admin", Port: 8080}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 3 {
+		t.Fatalf("Expected 3 EndpointSlices, got %d", len(endpointSlices))
+	}
+	existingSlices := []*discovery.EndpointSlice{}
+	for i := range endpointSlices {
+		existingSlices = append(existingSlices, &endpointSlices[i])
+	}
+
+	view := r.sliceTopologyView(tCtx.Logger(), &endpoints, existingSlices)
+	if view.Endpoints != "test/test-ep" {
+		t.Errorf("Expected view for test/test-ep, got %s", view.Endpoints)
+	}
+	if len(view.PortMaps) != 3 {
+		t.Fatalf("Expected 3 port maps in the view, got %d", len(view.PortMaps))
+	}
+
+	expectedDesired := map[string][]string{
+		"IPv4-443,80": {"10.0.0.1"},
+		"IPv6-443,80": {"2001:db8::1"},
+		"IPv4-8080":   {"10.0.0.2"},
+	}
+	for _, pm := range view.PortMaps {
+		portNums := []string{}
+		for _, port := range pm.Ports {
+			portNums = append(portNums, fmt.Sprintf("%d", *port.Port))
+		}
+		sort.Strings(portNums)
+		pmKey := fmt.Sprintf("%s-%s", pm.AddressType, strings.Join(portNums, ","))
+		desired, ok := expectedDesired[pmKey]
+		if !ok {
+			t.Errorf("Unexpected port map %s in the view", pmKey)
+			continue
+		}
+		delete(expectedDesired, pmKey)
+		if !reflect.DeepEqual(pm.Desired, desired) {
+			t.Errorf("Expected desired addresses %v for port map %s, got %v", desired, pmKey, pm.Desired)
+		}
+		if len(pm.Slices) != 1 {
+			t.Errorf("Expected 1 slice for port map %s, got %d", pmKey, len(pm.Slices))
+			continue
+		}
+		if pm.Slices[0].Name == "" {
+			t.Errorf("Expected a slice name for port map %s", pmKey)
+		}
+		if !reflect.DeepEqual(pm.Slices[0].Endpoints, desired) {
+			t.Errorf("Expected slice addresses %v for port map %s, got %v", desired, pmKey, pm.Slices[0].Endpoints)
+		}
+	}
+	for pmKey := range expectedDesired {
+		t.Errorf("Expected port map %s in the view", pmKey)
+	}
+}
+
+func TestReconcileHeadlessSubset(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// Headless-style subset: addresses with no ports.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Ports) != 0 {
+		t.Errorf("Expected empty Ports on the EndpointSlice, got %#v", endpointSlices[0].Ports)
+	}
+	if len(endpointSlices[0].Endpoints) != 2 {
+		t.Errorf("Expected 2 endpoints in the EndpointSlice, got %d", len(endpointSlices[0].Endpoints))
+	}
+	numActions := len(client.Actions())
+
+	// A second reconcile should match the slice under the same empty-port key
+	// and change nothing.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no client actions on the second reconcile, got %#v", client.Actions()[numActions:])
+	}
+}
+
+func TestReconcileOnSliceDeletedHook(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	portNum := int32(80)
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: portNum}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	deleted := []string{}
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.onSliceDeleted = func(namespace, name string) {
+		deleted = append(deleted, fmt.Sprintf("%s/%s", namespace, name))
+	}
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+	if len(deleted) != 0 {
+		t.Fatalf("Expected no deletions on the first reconcile, hook observed %v", deleted)
+	}
+
+	// Stale duplicate slices for the same port mapping are undesired and will
+	// be deleted; their names sort after the generated slice so the generated
+	// one is kept.
+	for _, name := range []string{"zzz-stale-1", "zzz-stale-2"} {
+		staleSlice := &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					discovery.LabelServiceName: endpoints.Name,
+					discovery.LabelManagedBy:   controllerName,
+				},
+			},
+			AddressType: discovery.AddressTypeIPv4,
+			Ports:       []discovery.EndpointPort{{Port: &portNum}},
+			Endpoints: []discovery.Endpoint{{
+				Addresses: []string{"10.0.0.2"},
+			}},
+		}
+		_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(tCtx, staleSlice, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error creating stale EndpointSlice, got %v", err)
+		}
+	}
+
+	fetched := fetchEndpointSlices(t, client, namespace)
+	existingSlices := make([]*discovery.EndpointSlice, 0, len(fetched))
+	for i := range fetched {
+		existingSlices = append(existingSlices, &fetched[i])
+	}
+	reconcileHelper(t, r, &endpoints, existingSlices)
+
+	sort.Strings(deleted)
+	expected := []string{"test/zzz-stale-1", "test/zzz-stale-2"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Expected the hook to observe deletions %v, got %v", expected, deleted)
+	}
+}
+
+func TestReconcileFQDNCanonicalization(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	fqdnType := discovery.AddressTypeFQDN
+
+	// Mixed-case names and trailing dots are cosmetic DNS variants of the
+	// same two names.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "Backend-1.Example.COM.",
+			}, {
+				IP: "backend-1.example.com",
+			}, {
+				IP: "BACKEND-2.example.com.",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.addressTypeResolver = func(address corev1.EndpointAddress) *discovery.AddressType {
+		return &fqdnType
+	}
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].AddressType != discovery.AddressTypeFQDN {
+		t.Errorf("Expected address type %s, got %s", discovery.AddressTypeFQDN, endpointSlices[0].AddressType)
+	}
+
+	mirroredAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		mirroredAddresses = append(mirroredAddresses, endpoint.Addresses[0])
+	}
+	sort.Strings(mirroredAddresses)
+	expected := []string{"backend-1.example.com", "backend-2.example.com"}
+	if !reflect.DeepEqual(mirroredAddresses, expected) {
+		t.Errorf("Expected canonical addresses %v, got %v", expected, mirroredAddresses)
+	}
+	numActions := len(client.Actions())
+
+	// The canonical forms must also match on the next reconcile so cosmetic
+	// variants do not churn the slice.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no client actions on the second reconcile, got %#v", client.Actions()[numActions:])
+	}
+}
+
+// TestReconcileRecycledWithPortChangeMetric ensures a recycle that rewrites
+// the slice's port map is counted by the RecycledWithPortChange metric.
+func TestReconcileRecycledWithPortChangeMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// The existing slice has a stale port mapping, so the recycle converting
+	// the create/delete pair into an update changes the slice's ports.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	actualPortChanges, err := testutil.GetCounterMetricValue(metrics.RecycledWithPortChange.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Failed to get RecycledWithPortChange metric: %v", err)
+	}
+	if actualPortChanges != 1 {
+		t.Errorf("Expected RecycledWithPortChange metric to be 1, got %v", actualPortChanges)
+	}
+}
+
+func TestReconcileEarlyFlushSlices(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	maxEndpoints := int32(10)
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+		}},
+	}
+	expectedAddresses := []string{}
+	for i := 1; i <= int(maxEndpoints); i++ {
+		address := fmt.Sprintf("10.0.0.%d", i)
+		endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: address})
+		expectedAddresses = append(expectedAddresses, address)
+	}
+
+	r := newReconciler(tCtx, client, maxEndpoints)
+	r.earlyFlushSlices = true
+
+	// Once the port mapping accumulates a full slice's worth of endpoints,
+	// they are drained into a completed batch and the live set stays empty,
+	// bounding the memory held in the hashed sets.
+	d, _, _, _ := r.desiredState(tCtx.Logger(), &endpoints)
+	for key, endpointSet := range d.endpointsByKey {
+		if endpointSet.Len() != 0 {
+			t.Errorf("Expected the live set for %s to be drained, got %d endpoints", key, endpointSet.Len())
+		}
+	}
+	numBatches := 0
+	for _, batches := range d.flushedByKey {
+		for _, batch := range batches {
+			numBatches++
+			if len(batch) != int(maxEndpoints) {
+				t.Errorf("Expected a completed batch of %d endpoints, got %d", maxEndpoints, len(batch))
+			}
+		}
+	}
+	if numBatches != 1 {
+		t.Errorf("Expected 1 completed batch, got %d", numBatches)
+	}
+
+	// The drained batch becomes a complete slice with the same contents the
+	// batch path would have produced.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	mirroredAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		mirroredAddresses = append(mirroredAddresses, endpoint.Addresses[0])
+	}
+	sort.Strings(mirroredAddresses)
+	sort.Strings(expectedAddresses)
+	if !reflect.DeepEqual(mirroredAddresses, expectedAddresses) {
+		t.Errorf("Expected addresses %v, got %v", expectedAddresses, mirroredAddresses)
+	}
+	numActions := len(client.Actions())
+
+	// With an existing slice the batches merge back into the live set, so the
+	// second reconcile matches it and changes nothing.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&endpointSlices[0]})
+	if len(client.Actions()) != numActions {
+		t.Errorf("Expected no client actions on the second reconcile, got %#v", client.Actions()[numActions:])
+	}
+}
+
+// TestReconcileErrorClassMetric ensures EndpointSlice write failures are
+// counted under the right error class.
+func TestReconcileErrorClassMetric(t *testing.T) {
+	testCases := []struct {
+		expectedClass string
+		injectedError error
+	}{{
+		expectedClass: "conflict",
+		injectedError: errors.NewConflict(discovery.Resource("endpointslices"), "foo", fmt.Errorf("conflict")),
+	}, {
+		expectedClass: "notfound",
+		injectedError: errors.NewNotFound(discovery.Resource("endpointslices"), "foo"),
+	}, {
+		expectedClass: "toolarge",
+		injectedError: errors.NewRequestEntityTooLargeError("too large"),
+	}, {
+		expectedClass: "forbidden",
+		injectedError: errors.NewForbidden(discovery.Resource("endpointslices"), "foo", fmt.Errorf("forbidden")),
+	}, {
+		expectedClass: "timeout",
+		injectedError: errors.NewTimeoutError("timeout", 1),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.expectedClass, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}},
+				}},
+			}
+
+			client.PrependReactor("create", "endpointslices", k8stesting.ReactionFunc(
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tc.injectedError
+				}))
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			err := r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{})
+			if err == nil {
+				t.Fatal("Expected reconcile to fail with the injected error, got no error")
+			}
+
+			actualErrors, err := testutil.GetCounterMetricValue(metrics.ReconcileErrors.WithLabelValues(tc.expectedClass))
+			if err != nil {
+				t.Fatalf("Failed to get ReconcileErrors metric: %v", err)
+			}
+			if actualErrors != 1 {
+				t.Errorf("Expected ReconcileErrors metric for class %s to be 1, got %v", tc.expectedClass, actualErrors)
+			}
+		})
+	}
+}
+
+// TestReconcileMixedFamilyPortMap ensures a port mapping that receives both
+// address families splits into one slice per family rather than mixing
+// families in a single slice.
+func TestReconcileMixedFamilyPortMap(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "2001:db8::1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	addressesByType := map[discovery.AddressType][]string{}
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Ports) != 1 || *epSlice.Ports[0].Port != 80 {
+			t.Errorf("Expected a single port 80 on EndpointSlice %s, got %#v", epSlice.Name, epSlice.Ports)
+		}
+		for _, endpoint := range epSlice.Endpoints {
+			addressesByType[epSlice.AddressType] = append(addressesByType[epSlice.AddressType], endpoint.Addresses...)
+		}
+	}
+	sort.Strings(addressesByType[discovery.AddressTypeIPv4])
+	if !reflect.DeepEqual(addressesByType[discovery.AddressTypeIPv4], []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expected IPv4 slice to hold the IPv4 addresses, got %v", addressesByType[discovery.AddressTypeIPv4])
+	}
+	if !reflect.DeepEqual(addressesByType[discovery.AddressTypeIPv6], []string{"2001:db8::1"}) {
+		t.Errorf("Expected IPv6 slice to hold the IPv6 address, got %v", addressesByType[discovery.AddressTypeIPv6])
+	}
+}
+
+// TestReconcileSliceByteBudget ensures a tight per-slice byte budget packs
+// endpoints into more, smaller slices.
+func TestReconcileSliceByteBudget(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// Each endpoint is estimated at roughly 108 bytes, so a 220 byte budget
+	// fits two endpoints per slice.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-ep",
+			Namespace:   namespace,
+			Annotations: map[string]string{sliceByteBudgetAnnotation: "220"},
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+		}},
+	}
+	expectedAddresses := []string{}
+	for i := 1; i <= 6; i++ {
+		address := fmt.Sprintf("10.0.0.%d", i)
+		endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: address})
+		expectedAddresses = append(expectedAddresses, address)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 3 {
+		t.Fatalf("Expected 3 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	mirroredAddresses := []string{}
+	for _, epSlice := range endpointSlices {
+		if len(epSlice.Endpoints) > 2 {
+			t.Errorf("Expected at most 2 endpoints per EndpointSlice under the budget, got %d in %s", len(epSlice.Endpoints), epSlice.Name)
+		}
+		for _, endpoint := range epSlice.Endpoints {
+			mirroredAddresses = append(mirroredAddresses, endpoint.Addresses...)
+		}
+	}
+	sort.Strings(mirroredAddresses)
+	if !reflect.DeepEqual(mirroredAddresses, expectedAddresses) {
+		t.Errorf("Expected addresses %v, got %v", expectedAddresses, mirroredAddresses)
+	}
+}
+
+// TestReconcileSliceRecycledEvent ensures a recycle that repurposes a slice
+// under its existing name is reported through an event.
+func TestReconcileSliceRecycledEvent(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// The existing slice has a stale port mapping, so reconcile repurposes it
+	// to hold the desired ports instead of deleting and recreating it.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	recorder := record.NewFakeRecorder(10)
+	r.eventRecorder = recorder
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	expectedEvent := "Normal SliceRecycled Repurposed EndpointSlices [test-ep-1] instead of deleting and recreating them"
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("Expected event %q, got %q", expectedEvent, event)
+		}
+	default:
+		t.Error("Expected a SliceRecycled event, got none")
+	}
+}
+
+// TestReconcileIgnoreHints ensures the ignoreHints toggle strips Hints from
+// endpoint comparison before any configured comparator runs, so hint-only
+// differences do not trigger updates.
+func TestReconcileIgnoreHints(t *testing.T) {
+	// A comparator that treats hint differences as changes, standing in for
+	// environments that compare endpoints strictly.
+	strictComparator := func(a, b *discovery.Endpoint) bool {
+		return endpointsliceutil.EndpointsEqualBeyondHash(a, b) && reflect.DeepEqual(a.Hints, b.Hints)
+	}
+
+	testCases := []struct {
+		testCase     string
+		ignoreHints  bool
+		expectUpdate bool
+	}{{
+		testCase:     "hint-only difference updates under a strict comparator",
+		ignoreHints:  false,
+		expectUpdate: true,
+	}, {
+		testCase:     "hint-only difference ignored with the toggle on",
+		ignoreHints:  true,
+		expectUpdate: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+			protoTCP := corev1.ProtocolTCP
+
+			existingSlice := &discovery.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-ep-1",
+					Namespace: namespace,
+					Labels: map[string]string{
+						discovery.LabelServiceName: "test-ep",
+						discovery.LabelManagedBy:   controllerName,
+					},
+				},
+				AddressType: discovery.AddressTypeIPv4,
+				Ports: []discovery.EndpointPort{{
+					Name:     pointer.String(""),
+					Port:     pointer.Int32(80),
+					Protocol: &protoTCP,
+				}},
+				Endpoints: []discovery.Endpoint{{
+					Addresses:  []string{"10.0.0.1"},
+					Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+					Hints: &discovery.EndpointHints{
+						ForZones: []discovery.ForZone{{Name: "zone-a"}},
+					},
+				}},
+			}
+			if _, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{}); err != nil {
+				t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+			}
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.endpointComparator = strictComparator
+			r.ignoreHints = tc.ignoreHints
+			client.ClearActions()
+			reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+			if tc.expectUpdate && len(client.Actions()) == 0 {
+				t.Errorf("Expected the hint-only difference to trigger an update, got no client actions")
+			}
+			if !tc.expectUpdate && len(client.Actions()) != 0 {
+				t.Errorf("Expected no api calls for a hint-only difference, got %d: %#v", len(client.Actions()), client.Actions())
+			}
+		})
+	}
+}
+
+// TestReconcileInvariantCheck ensures the opt-in post-condition check stays
+// quiet on a converged sync and detects a plan that leaves the written slices
+// holding fewer endpoints than desired.
+func TestReconcileInvariantCheck(t *testing.T) {
+	testCases := []struct {
+		testCase           string
+		maxChangesPerSync  int
+		expectedViolations float64
+	}{{
+		testCase:           "invariant holds",
+		maxChangesPerSync:  0,
+		expectedViolations: 0,
+	}, {
+		testCase: "deferred changes violate the invariant",
+		// Capping changes at 1 leaves two of the three desired additions for
+		// later syncs, so the written slices hold fewer endpoints than
+		// desired and the check detects it.
+		maxChangesPerSync:  1,
+		expectedViolations: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+			namespace := "test"
+			protoTCP := corev1.ProtocolTCP
+
+			existingSlice := &discovery.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-ep-1",
+					Namespace: namespace,
+					Labels: map[string]string{
+						discovery.LabelServiceName: "test-ep",
+						discovery.LabelManagedBy:   controllerName,
+					},
+				},
+				AddressType: discovery.AddressTypeIPv4,
+				Ports: []discovery.EndpointPort{{
+					Name:     pointer.String(""),
+					Port:     pointer.Int32(80),
+					Protocol: &protoTCP,
+				}},
+				Endpoints: []discovery.Endpoint{{
+					Addresses:  []string{"10.0.0.1"},
+					Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+				}},
+			}
+			_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(tCtx, existingSlice, metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+			}
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}, {
+						IP: "10.0.0.2",
+					}, {
+						IP: "10.0.0.3",
+					}, {
+						IP: "10.0.0.4",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			r.verifyInvariants = true
+			r.maxChangesPerSync = tc.maxChangesPerSync
+			err = r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{existingSlice})
+			if tc.maxChangesPerSync > 0 {
+				// The capped sync defers changes and suggests a requeue.
+				if _, ok := suggestedRequeueDelay(err); !ok {
+					t.Fatalf("Expected a requeue to be suggested while changes are deferred, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Expected no error reconciling Endpoint Slices, got: %v", err)
+			}
+
+			actualViolations, err := testutil.GetCounterMetricValue(metrics.InvariantViolations.WithLabelValues())
+			if err != nil {
+				t.Fatalf("Failed to get InvariantViolations metric: %v", err)
+			}
+			if actualViolations != tc.expectedViolations {
+				t.Errorf("Expected InvariantViolations metric to be %v, got %v", tc.expectedViolations, actualViolations)
+			}
+		})
+	}
+}
+
+// TestReconcileAddressFamilyChange ensures an endpoint whose IP changes
+// family between syncs migrates cleanly: the old family's slice entry is
+// removed and the new family's added in the same sync.
+func TestReconcileAddressFamilyChange(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+	targetRef := &corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: "pod-1", UID: "uid-1"}
+
+	// The existing slice mirrors the backend's previous IPv4 address.
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-1",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: "test-ep",
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Name:     pointer.String(""),
+			Port:     pointer.Int32(80),
+			Protocol: &protoTCP,
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+			TargetRef:  targetRef,
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(tCtx, existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	// The same backend now reports an IPv6 address.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80, Protocol: protoTCP}},
+			Addresses: []corev1.EndpointAddress{{
+				IP:        "2001:db8::1",
+				TargetRef: targetRef,
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{existingSlice})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice after the family change, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].AddressType != discovery.AddressTypeIPv6 {
+		t.Errorf("Expected address type %s, got %s", discovery.AddressTypeIPv6, endpointSlices[0].AddressType)
+	}
+	if len(endpointSlices[0].Endpoints) != 1 || endpointSlices[0].Endpoints[0].Addresses[0] != "2001:db8::1" {
+		t.Errorf("Expected a single endpoint with the new IPv6 address, got %#v", endpointSlices[0].Endpoints)
+	}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		if endpoint.TargetRef == nil || endpoint.TargetRef.Name != targetRef.Name {
+			t.Errorf("Expected the migrated endpoint to keep its TargetRef, got %#v", endpoint.TargetRef)
+		}
+	}
+}
+
+// TestReconcilerEffectiveConfiguration ensures the configuration summary
+// logged at startup reflects the constructed options.
+func TestReconcilerEffectiveConfiguration(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+
+	r := newReconciler(tCtx, client, int32(50))
+	r.maxSubsets = 5
+	r.maxChangesPerSync = 7
+	r.adoptUnmanaged = true
+	r.verifyInvariants = true
+
+	config := r.effectiveConfiguration()
+	expected := map[string]interface{}{
+		"managedBy":             controllerName,
+		"maxEndpointsPerSubset": int32(50),
+		"maxSubsets":            int32(5),
+		"maxChangesPerSync":     7,
+		"adoptUnmanaged":        true,
+		"deferSliceDeletion":    false,
+		"verifyInvariants":      true,
+	}
+	for key, expectedVal := range expected {
+		actualVal, ok := config[key]
+		if !ok {
+			t.Errorf("Expected configuration summary to include %s", key)
+			continue
+		}
+		if !reflect.DeepEqual(actualVal, expectedVal) {
+			t.Errorf("Expected configuration %s to be %v, got %v", key, expectedVal, actualVal)
+		}
+	}
+}
+
+// TestReconcileRepackOnQuota ensures a create rejected by an apiserver slice
+// quota is recovered from by folding its endpoints into a slice created
+// earlier in the same sync.
+func TestReconcileRepackOnQuota(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// The byte budget splits the 4 endpoints into 2 planned creates, but the
+	// simulated quota only admits 1 slice.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-ep",
+			Namespace:   namespace,
+			Annotations: map[string]string{sliceByteBudgetAnnotation: "220"},
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+		}},
+	}
+	expectedAddresses := []string{}
+	for i := 1; i <= 4; i++ {
+		address := fmt.Sprintf("10.0.0.%d", i)
+		endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{IP: address})
+		expectedAddresses = append(expectedAddresses, address)
+	}
+
+	createdSlices := 0
+	client.PrependReactor("create", "endpointslices", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if createdSlices >= 1 {
+			return true, nil, errors.NewForbidden(discovery.Resource("endpointslices"), "", fmt.Errorf("exceeded quota: endpointslice-quota, limited: 1"))
+		}
+		createdSlices++
+		return false, nil, nil
+	})
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.repackOnQuota = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice within the quota, got %d", len(endpointSlices))
+	}
+
+	mirroredAddresses := []string{}
+	for _, endpoint := range endpointSlices[0].Endpoints {
+		mirroredAddresses = append(mirroredAddresses, endpoint.Addresses...)
+	}
+	sort.Strings(mirroredAddresses)
+	if !reflect.DeepEqual(mirroredAddresses, expectedAddresses) {
+		t.Errorf("Expected addresses %v, got %v", expectedAddresses, mirroredAddresses)
+	}
+}
+
+// TestReconcileDefaultAddressType ensures addresses whose family cannot be
+// inferred fall back to the configured default AddressType instead of being
+// dropped.
+func TestReconcileDefaultAddressType(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// The DNS name does not parse as an IP, so its family is ambiguous.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "backend-1.example.com",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.defaultAddressType = discovery.AddressTypeFQDN
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	addressesByType := map[discovery.AddressType][]string{}
+	for _, epSlice := range endpointSlices {
+		for _, endpoint := range epSlice.Endpoints {
+			addressesByType[epSlice.AddressType] = append(addressesByType[epSlice.AddressType], endpoint.Addresses...)
+		}
+	}
+	if !reflect.DeepEqual(addressesByType[discovery.AddressTypeIPv4], []string{"10.0.0.1"}) {
+		t.Errorf("Expected IPv4 addresses [10.0.0.1], got %v", addressesByType[discovery.AddressTypeIPv4])
+	}
+	if !reflect.DeepEqual(addressesByType[discovery.AddressTypeFQDN], []string{"backend-1.example.com"}) {
+		t.Errorf("Expected FQDN addresses [backend-1.example.com], got %v", addressesByType[discovery.AddressTypeFQDN])
+	}
+}
+
+// TestReconcileSourceSubsetsAnnotation ensures written slices are stamped
+// with the source subset index of each of their endpoints.
+func TestReconcileSourceSubsetsAnnotation(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}, {
+				IP: "10.0.0.2",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.3",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.annotateSourceSubsets = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(endpointSlices))
+	}
+
+	// Collect the annotated subset index of each mirrored address. The
+	// indices refer to the canonicalized subset order, so assert the grouping
+	// rather than specific values.
+	indexByAddress := map[string]string{}
+	for _, epSlice := range endpointSlices {
+		annotation, ok := epSlice.Annotations[sourceSubsetsAnnotation]
+		if !ok {
+			t.Fatalf("Expected EndpointSlice %s to have a %s annotation", epSlice.Name, sourceSubsetsAnnotation)
+		}
+		indices := strings.Split(annotation, ",")
+		if len(indices) != len(epSlice.Endpoints) {
+			t.Fatalf("Expected %d annotated indices for EndpointSlice %s, got %d", len(epSlice.Endpoints), epSlice.Name, len(indices))
+		}
+		for i, endpoint := range epSlice.Endpoints {
+			indexByAddress[endpoint.Addresses[0]] = indices[i]
+		}
+	}
+
+	if indexByAddress["10.0.0.1"] != indexByAddress["10.0.0.2"] {
+		t.Errorf("Expected addresses from the same subset to share an index, got %v", indexByAddress)
+	}
+	if indexByAddress["10.0.0.1"] == indexByAddress["10.0.0.3"] {
+		t.Errorf("Expected addresses from different subsets to have different indices, got %v", indexByAddress)
+	}
+	for address, index := range indexByAddress {
+		if index != "0" && index != "1" {
+			t.Errorf("Expected index of %s to be 0 or 1, got %s", address, index)
+		}
+	}
+}
+
+// TestReconcileNilSliceOnCreate ensures a client that returns neither a slice
+// nor an error on create fails the sync instead of panicking in the tracker.
+func TestReconcileNilSliceOnCreate(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.sliceStorage = nilSliceStorage{}
+	err := r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{})
+	if err == nil {
+		t.Fatal("Expected reconcile to fail when the client returned a nil EndpointSlice, got no error")
+	}
+
+	actualErrors, err := testutil.GetCounterMetricValue(metrics.ReconcileErrors.WithLabelValues("other"))
+	if err != nil {
+		t.Fatalf("Failed to get ReconcileErrors metric: %v", err)
+	}
+	if actualErrors != 1 {
+		t.Errorf("Expected ReconcileErrors metric to be 1, got %v", actualErrors)
+	}
+}
+
+// TestReconcileMalformedEndpoints ensures an Endpoints resource without a
+// name or namespace is rejected before any slices are written.
+func TestReconcileMalformedEndpoints(t *testing.T) {
+	testCases := []struct {
+		testName  string
+		name      string
+		namespace string
+	}{{
+		testName:  "empty name",
+		name:      "",
+		namespace: "test",
+	}, {
+		testName:  "empty namespace",
+		name:      "test-ep",
+		namespace: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			tCtx := ktesting.Init(t)
+			client := newClientset()
+			setupMetrics()
+
+			endpoints := corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: tc.name, Namespace: tc.namespace},
+				Subsets: []corev1.EndpointSubset{{
+					Ports: []corev1.EndpointPort{{Port: 80}},
+					Addresses: []corev1.EndpointAddress{{
+						IP: "10.0.0.1",
+					}},
+				}},
+			}
+
+			r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+			err := r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{})
+			if err == nil {
+				t.Fatal("Expected reconcile to reject the malformed Endpoints, got no error")
+			}
+			if len(client.Actions()) != 0 {
+				t.Errorf("Expected no API actions for a malformed Endpoints, got %d", len(client.Actions()))
+			}
+		})
+	}
+}
+
+// TestReconcileSliceMatchRatioMetric ensures the fraction of port mappings
+// matched without writes is observed on each sync.
+func TestReconcileSliceMatchRatioMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// Two subsets with distinct ports produce two port mappings.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	// The first sync regenerates both port mappings, observing a ratio of 0.
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	fetched := fetchEndpointSlices(t, client, namespace)
+	if len(fetched) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(fetched))
+	}
+	existingSlices := make([]*discovery.EndpointSlice, 0, len(fetched))
+	for i := range fetched {
+		existingSlices = append(existingSlices, &fetched[i])
+	}
+
+	// The second sync changes only one subset, so one port mapping is matched
+	// and the other regenerated, observing a ratio of 0.5.
+	endpoints.Subsets[1].Addresses = append(endpoints.Subsets[1].Addresses, corev1.EndpointAddress{IP: "10.0.0.3"})
+	reconcileHelper(t, r, &endpoints, existingSlices)
+
+	actualRatio, err := testutil.GetHistogramMetricValue(metrics.SliceMatchRatio.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Failed to get SliceMatchRatio metric: %v", err)
+	}
+	if actualRatio != 0.5 {
+		t.Errorf("Expected SliceMatchRatio metric sum to be 0.5, got %v", actualRatio)
+	}
+}
+
+// TestReconcileMaxTerminalPodAge ensures endpoints whose pods have been in a
+// terminal phase beyond the configured age are dropped as stale.
+func TestReconcileMaxTerminalPodAge(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// pod-1 failed two hours ago; pod-2 is still running.
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	terminalPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: namespace},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{
+						FinishedAt: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+					},
+				},
+			}},
+		},
+	}
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-2", Namespace: namespace},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, pod := range []*corev1.Pod{terminalPod, runningPod} {
+		if err := indexer.Add(pod); err != nil {
+			t.Fatalf("Expected no error adding Pod, got %v", err)
+		}
+	}
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{{Port: 80}},
+	}
+	for i := 1; i <= 2; i++ {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.0.%d", i),
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: namespace,
+				Name:      fmt.Sprintf("pod-%d", i),
+			},
+		})
+	}
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.podLister = corelisters.NewPodLister(indexer)
+	r.maxTerminalPodAge = time.Hour
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 1 {
+		t.Fatalf("Expected 1 endpoint, got %d", len(endpointSlices[0].Endpoints))
+	}
+	if endpointSlices[0].Endpoints[0].Addresses[0] != "10.0.0.2" {
+		t.Errorf("Expected only the running pod's address to be mirrored, got %v", endpointSlices[0].Endpoints[0].Addresses)
+	}
+}
+
+// TestReconcileCreateBeforeDelete ensures a failed create withholds the
+// sync's deletes and rolls back the slices created earlier in the sync.
+func TestReconcileCreateBeforeDelete(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// Two subsets with distinct ports plan two creates; the stale IPv6 slice
+	// plans a delete that cannot be recycled across address families.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	existingSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-ipv6",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv6,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"2001:db8::1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), existingSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	// The first create succeeds, any further create fails.
+	createdSlices := 0
+	client.PrependReactor("create", "endpointslices", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if createdSlices >= 1 {
+			return true, nil, errors.NewInternalError(fmt.Errorf("injected create failure"))
+		}
+		createdSlices++
+		return false, nil, nil
+	})
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.createBeforeDelete = true
+	err = r.reconcile(tCtx.Logger(), &endpoints, []*discovery.EndpointSlice{existingSlice})
+	if err == nil {
+		t.Fatal("Expected reconcile to fail with the injected create error, got no error")
+	}
+
+	// The delete was withheld and the successful create rolled back, so only
+	// the stale slice remains.
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice after the failed sync, got %d", len(endpointSlices))
+	}
+	if endpointSlices[0].Name != existingSlice.Name {
+		t.Errorf("Expected only EndpointSlice %s to remain, got %s", existingSlice.Name, endpointSlices[0].Name)
+	}
+}
+
+// TestReconcileSkipNativelyManaged ensures mirroring is skipped, and existing
+// mirrored slices cleaned up, when the Service already has EndpointSlices
+// managed by the native EndpointSlice controller.
+func TestReconcileSkipNativelyManaged(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	serviceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := serviceIndexer.Add(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: endpoints.Name, Namespace: namespace},
+	}); err != nil {
+		t.Fatalf("Expected no error adding Service, got %v", err)
+	}
+
+	// The native controller already produces a slice for this Service.
+	sliceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := sliceIndexer.Add(&discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-native",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   nativeControllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+	}); err != nil {
+		t.Fatalf("Expected no error adding EndpointSlice, got %v", err)
+	}
+
+	// A slice mirrored before the Service became natively managed.
+	mirroredSlice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ep-mirror",
+			Namespace: namespace,
+			Labels: map[string]string{
+				discovery.LabelServiceName: endpoints.Name,
+				discovery.LabelManagedBy:   controllerName,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Ports: []discovery.EndpointPort{{
+			Port: pointer.Int32(80),
+		}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discovery.EndpointConditions{Ready: pointer.Bool(true)},
+		}},
+	}
+	_, err := client.DiscoveryV1().EndpointSlices(namespace).Create(context.TODO(), mirroredSlice, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error creating EndpointSlice, got %v", err)
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.serviceLister = corelisters.NewServiceLister(serviceIndexer)
+	r.endpointSliceLister = discoverylisters.NewEndpointSliceLister(sliceIndexer)
+	r.skipNativelyManaged = true
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{mirroredSlice})
+
+	// Mirroring was skipped and the stale mirror deleted.
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 0 {
+		t.Errorf("Expected no mirrored EndpointSlices, got %d", len(endpointSlices))
+	}
+}
+
+// TestReconcileSliceSizeMetric ensures the estimated serialized size of each
+// written slice is observed.
+func TestReconcileSliceSizeMetric(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+		}},
+	}
+	for i := 1; i <= 100; i++ {
+		endpoints.Subsets[0].Addresses = append(endpoints.Subsets[0].Addresses, corev1.EndpointAddress{
+			IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: namespace,
+				Name:      fmt.Sprintf("pod-%d", i),
+			},
+		})
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+
+	actualSize, err := testutil.GetHistogramMetricValue(metrics.SliceSizeBytes.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Failed to get SliceSizeBytes metric: %v", err)
+	}
+	expectedSize := float64(estimateSliceSize(&endpointSlices[0]))
+	if actualSize != expectedSize {
+		t.Errorf("Expected SliceSizeBytes metric sum to be %v, got %v", expectedSize, actualSize)
+	}
+	// 100 endpoints with addresses and target refs cannot plausibly estimate
+	// below this floor.
+	if actualSize < 10000 {
+		t.Errorf("Expected the estimated size of a 100 endpoint slice to exceed 10000 bytes, got %v", actualSize)
+	}
+}
+
+// recordingBatcher is an updateBatcher that records how updates were grouped
+// while delegating the writes per object.
+type recordingBatcher struct {
+	groups [][]string
+}
+
+func (b *recordingBatcher) update(ctx context.Context, storage sliceStorage, namespace string, slices []*discovery.EndpointSlice) ([]*discovery.EndpointSlice, int, error) {
+	names := []string{}
+	updated := []*discovery.EndpointSlice{}
+	for _, endpointSlice := range slices {
+		names = append(names, endpointSlice.Name)
+		updatedSlice, err := storage.Update(ctx, namespace, endpointSlice)
+		if err != nil {
+			return updated, 1, err
+		}
+		updated = append(updated, updatedSlice)
+	}
+	b.groups = append(b.groups, names)
+	return updated, 1, nil
+}
+
+// TestReconcileUpdateBatcher ensures the updates of a sync are submitted
+// through the configured batcher as a single group.
+func TestReconcileUpdateBatcher(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	// Two subsets with distinct ports produce two slices to update.
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}, {
+			Ports: []corev1.EndpointPort{{Port: 443}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.2",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	fetched := fetchEndpointSlices(t, client, namespace)
+	if len(fetched) != 2 {
+		t.Fatalf("Expected 2 EndpointSlices, got %d", len(fetched))
+	}
+	existingSlices := make([]*discovery.EndpointSlice, 0, len(fetched))
+	for i := range fetched {
+		existingSlices = append(existingSlices, &fetched[i])
+	}
+
+	// Change both subsets so the second sync updates both slices.
+	endpoints.Subsets[0].Addresses[0].IP = "10.0.0.3"
+	endpoints.Subsets[1].Addresses[0].IP = "10.0.0.4"
+
+	batcher := &recordingBatcher{}
+	r.updateBatcher = batcher
+	reconcileHelper(t, r, &endpoints, existingSlices)
+
+	if len(batcher.groups) != 1 {
+		t.Fatalf("Expected updates to be submitted as 1 group, got %d", len(batcher.groups))
+	}
+	if len(batcher.groups[0]) != 2 {
+		t.Errorf("Expected 2 updates in the group, got %v", batcher.groups[0])
+	}
+
+	mirroredAddresses := []string{}
+	for _, epSlice := range fetchEndpointSlices(t, client, namespace) {
+		for _, endpoint := range epSlice.Endpoints {
+			mirroredAddresses = append(mirroredAddresses, endpoint.Addresses...)
+		}
+	}
+	sort.Strings(mirroredAddresses)
+	if !reflect.DeepEqual(mirroredAddresses, []string{"10.0.0.3", "10.0.0.4"}) {
+		t.Errorf("Expected addresses [10.0.0.3 10.0.0.4], got %v", mirroredAddresses)
+	}
+}
+
+// TestReconcileSliceHistory ensures the prior generation of an updated slice
+// is retained under the history label and pruned beyond the configured count.
+func TestReconcileSliceHistory(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.historyLimit = 2
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	fetchHistory := func() []discovery.EndpointSlice {
+		t.Helper()
+		historySlices, err := client.DiscoveryV1().EndpointSlices(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: sliceHistoryLabel + "=" + endpoints.Name,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error listing history EndpointSlices, got %v", err)
+		}
+		return historySlices.Items
+	}
+	updateWithAddress := func(address string) {
+		t.Helper()
+		fetched := fetchEndpointSlices(t, client, namespace)
+		if len(fetched) != 1 {
+			t.Fatalf("Expected 1 EndpointSlice, got %d", len(fetched))
+		}
+		endpoints.Subsets[0].Addresses[0].IP = address
+		reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{&fetched[0]})
+	}
+
+	// Creates retain nothing.
+	if history := fetchHistory(); len(history) != 0 {
+		t.Fatalf("Expected no history EndpointSlices after a create, got %d", len(history))
+	}
+
+	sliceName := fetchEndpointSlices(t, client, namespace)[0].Name
+	updateWithAddress("10.0.0.2")
+
+	history := fetchHistory()
+	if len(history) != 1 {
+		t.Fatalf("Expected 1 history EndpointSlice after an update, got %d", len(history))
+	}
+	if history[0].Annotations[historyOfAnnotation] != sliceName {
+		t.Errorf("Expected history to name slice %s, got %s", sliceName, history[0].Annotations[historyOfAnnotation])
+	}
+	if len(history[0].Endpoints) != 1 || history[0].Endpoints[0].Addresses[0] != "10.0.0.1" {
+		t.Errorf("Expected the retained copy to hold the prior address 10.0.0.1, got %v", history[0].Endpoints)
+	}
+	if history[0].Labels[discovery.LabelManagedBy] != "" {
+		t.Errorf("Expected the retained copy not to carry the managed-by label, got %s", history[0].Labels[discovery.LabelManagedBy])
+	}
+	if history[0].Labels[discovery.LabelServiceName] != "" {
+		t.Errorf("Expected the retained copy not to carry the service-name label, got %s", history[0].Labels[discovery.LabelServiceName])
+	}
+
+	// Two more updates exceed the limit, so the oldest copy is pruned.
+	updateWithAddress("10.0.0.3")
+	updateWithAddress("10.0.0.4")
+	if history := fetchHistory(); len(history) != 2 {
+		t.Errorf("Expected history to be pruned to 2 EndpointSlices, got %d", len(history))
+	}
+}
+
+// TestReconcileDesiredCalcFactory ensures reconcile computes its desired
+// state through the configured factory.
+func TestReconcileDesiredCalcFactory(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Port: 80}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	factoryCalls := 0
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	r.desiredCalcFactory = func() *desiredCalc {
+		factoryCalls++
+		return newDesiredCalc()
+	}
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	if factoryCalls != 1 {
+		t.Errorf("Expected the desiredCalc factory to be used once, got %d", factoryCalls)
+	}
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Endpoints) != 1 || endpointSlices[0].Endpoints[0].Addresses[0] != "10.0.0.1" {
+		t.Errorf("Expected the factory-backed sync to mirror 10.0.0.1, got %v", endpointSlices[0].Endpoints)
+	}
+}
+
+// TestReconcileDuplicateProtocolPorts ensures ports sharing a name and number
+// but differing in protocol are mirrored as distinct ports and reported.
+func TestReconcileDuplicateProtocolPorts(t *testing.T) {
+	tCtx := ktesting.Init(t)
+	client := newClientset()
+	setupMetrics()
+	namespace := "test"
+	protoTCP := corev1.ProtocolTCP
+	protoUDP := corev1.ProtocolUDP
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ep", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{
+				Name:     "dns",
+				Port:     53,
+				Protocol: protoTCP,
+			}, {
+				Name:     "dns",
+				Port:     53,
+				Protocol: protoUDP,
+			}},
+			Addresses: []corev1.EndpointAddress{{
+				IP: "10.0.0.1",
+			}},
+		}},
+	}
+
+	r := newReconciler(tCtx, client, defaultMaxEndpointsPerSubset)
+	reconcileHelper(t, r, &endpoints, []*discovery.EndpointSlice{})
+
+	endpointSlices := fetchEndpointSlices(t, client, namespace)
+	if len(endpointSlices) != 1 {
+		t.Fatalf("Expected 1 EndpointSlice, got %d", len(endpointSlices))
+	}
+	if len(endpointSlices[0].Ports) != 2 {
+		t.Fatalf("Expected both protocol variants of the port to be mirrored, got %v", endpointSlices[0].Ports)
+	}
+	protocols := map[corev1.Protocol]bool{}
+	for _, port := range endpointSlices[0].Ports {
+		if *port.Name != "dns" || *port.Port != 53 {
+			t.Errorf("Expected port dns/53, got %s/%d", *port.Name, *port.Port)
+		}
+		protocols[*port.Protocol] = true
+	}
+	if !protocols[protoTCP] || !protocols[protoUDP] {
+		t.Errorf("Expected both TCP and UDP variants of the port, got %v", endpointSlices[0].Ports)
+	}
+
+	actualDuplicates, err := testutil.GetCounterMetricValue(metrics.DuplicateProtocolPorts.WithLabelValues())
+	if err != nil {
+		t.Fatalf("Error getting DuplicateProtocolPorts metric: %v", err)
+	}
+	if actualDuplicates != 1 {
+		t.Errorf("Expected 1 duplicate protocol port to be reported, got %v", actualDuplicates)
+	}
+}
+
 // Test Helpers
 
 func newReconciler(ctx context.Context, client *fake.Clientset, maxEndpointsPerSubset int32) *reconciler {
@@ -1417,7 +7121,23 @@ func setupMetrics() {
 	metrics.EndpointsUpdatedPerSync.Delete(map[string]string{})
 	metrics.EndpointsRemovedPerSync.Delete(map[string]string{})
 	metrics.AddressesSkippedPerSync.Delete(map[string]string{})
+	metrics.SlicesUnchanged.Delete(map[string]string{})
+	metrics.SlicesRecycled.Delete(map[string]string{})
+	metrics.RecycledWithPortChange.Delete(map[string]string{})
+	metrics.ReconcileErrors.Reset()
+	metrics.InvariantViolations.Delete(map[string]string{})
+	metrics.HashMismatches.Delete(map[string]string{})
+	metrics.ApiCallsPerSync.Delete(map[string]string{})
+	metrics.AddressesInMultiplePortMaps.Delete(map[string]string{})
+	metrics.CrossFamilyAddresses.Delete(map[string]string{})
 	metrics.EndpointSliceChanges.Delete(map[string]string{"operation": "create"})
 	metrics.EndpointSliceChanges.Delete(map[string]string{"operation": "update"})
 	metrics.EndpointSliceChanges.Delete(map[string]string{"operation": "delete"})
+	metrics.DuplicateProtocolPorts.Delete(map[string]string{})
+	metrics.DistinctPortMaps.Delete(map[string]string{})
+	metrics.SliceMatchRatio.Delete(map[string]string{})
+	metrics.SliceSizeBytes.Delete(map[string]string{})
+	metrics.SubsetAddressCount.Delete(map[string]string{})
+	metrics.EndpointsPerAddressType.Reset()
+	metrics.ZoneDistribution.Reset()
 }
@@ -17,34 +17,112 @@ limitations under the License.
 package endpointslicemirroring
 
 import (
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/rand"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	endpointsliceutil "k8s.io/endpointslice/util"
 	"k8s.io/kubernetes/pkg/apis/discovery/validation"
+	hashutil "k8s.io/kubernetes/pkg/util/hash"
 	netutils "k8s.io/utils/net"
 )
 
+// targetSlicesAnnotation is an annotation that can be set on an Endpoints
+// resource to request that mirrored endpoints are distributed as evenly as
+// possible across an exact number of EndpointSlices per port mapping.
+const targetSlicesAnnotation = "endpointslice.kubernetes.io/target-slices"
+
+// sliceByteBudgetAnnotation is an annotation that can be set on an Endpoints
+// resource to cap the approximate serialized size of each mirrored
+// EndpointSlice, packing endpoints into more, smaller slices to stay under
+// etcd object size limits proactively.
+const sliceByteBudgetAnnotation = "endpointslice.kubernetes.io/slice-byte-budget"
+
+const (
+	// contentHashAnnotation stores a hash of the mirrored content of an
+	// EndpointSlice: its address type, ports, and endpoints.
+	contentHashAnnotation = "endpointslice.kubernetes.io/content-hash"
+	// contentGenerationAnnotation stores a monotonically increasing counter
+	// that changes only when the mirrored content of an EndpointSlice
+	// changes.
+	contentGenerationAnnotation = "endpointslice.kubernetes.io/content-generation"
+	// truncatedAnnotation marks an EndpointSlice as belonging to a truncated
+	// set: one or more addresses from the Endpoints resource were not
+	// mirrored because they exceeded MaxEndpointsPerSubset.
+	truncatedAnnotation = "endpointslice.kubernetes.io/endpoints-truncated"
+	// externalAddressesLabel marks an EndpointSlice as holding addresses
+	// without a TargetRef, which may be external backends.
+	externalAddressesLabel = "endpointslice.kubernetes.io/external-addresses"
+	// mirroredResourceVersionAnnotation stores the resource version of the
+	// Endpoints resource a slice was last mirrored from, serving as an
+	// idempotency token for replayed syncs.
+	mirroredResourceVersionAnnotation = "endpointslice.kubernetes.io/mirrored-resource-version"
+	// stableIdentifierAnnotation stores a deterministic identifier derived
+	// from the Endpoints name, port mapping, and address type of a mirrored
+	// EndpointSlice. Unlike the slice UID it survives a delete and recreate.
+	stableIdentifierAnnotation = "endpointslice.kubernetes.io/stable-identifier"
+	// endpointWeightsAnnotation holds, on an Endpoints resource, a JSON map of
+	// address to weight for weighted load balancing consumers. On a mirrored
+	// EndpointSlice it holds the weights of the endpoints in that slice.
+	endpointWeightsAnnotation = "endpointslice.kubernetes.io/endpoint-weights"
+	// sliceHistoryLabel marks a retained copy of a mirrored EndpointSlice
+	// taken before an update overwrote it, holding the name of the Endpoints
+	// resource it was mirrored for. Retained copies deliberately do not carry
+	// the managed-by label so they are invisible to the mirroring logic.
+	sliceHistoryLabel = "endpointslice.kubernetes.io/history-for"
+	// historyOfAnnotation holds, on a retained copy, the name of the
+	// EndpointSlice it was a generation of.
+	historyOfAnnotation = "endpointslice.kubernetes.io/history-of"
+	// sourceSubsetsAnnotation holds, on a mirrored EndpointSlice, the index of
+	// the canonicalized source subset each endpoint was mirrored from, as a
+	// comma-separated list aligned with the slice's endpoint order.
+	sourceSubsetsAnnotation = "endpointslice.kubernetes.io/source-subsets"
+	// pendingDeleteAnnotation marks an EndpointSlice that is no longer desired
+	// but whose deletion has been deferred to the next reconcile in case the
+	// informer cache was transiently stale.
+	pendingDeleteAnnotation = "endpointslice.kubernetes.io/pending-delete"
+)
+
+// maxPortsPerSlice is the maximum number of ports a single EndpointSlice can
+// hold, as enforced by discovery validation.
+const maxPortsPerSlice = 100
+
+// maxAddressHostnameLength is the longest hostname accepted on a mirrored
+// address. Longer values cannot be valid DNS subdomains and only bloat the
+// generated EndpointSlices.
+const maxAddressHostnameLength = 253
+
 // addrTypePortMapKey is used to uniquely identify groups of endpoint ports and
-// address types.
+// address types. The address family is part of the key, so a port mapping
+// that receives both IPv4 and IPv6 addresses splits into one group per
+// family; a single EndpointSlice never mixes address families.
 type addrTypePortMapKey string
 
-// newAddrTypePortMapKey generates a PortMapKey from endpoint ports.
+// newAddrTypePortMapKey generates a PortMapKey from endpoint ports. An empty
+// ports list hashes to a stable empty-port key, so headless-style subsets
+// (addresses without ports) group and match consistently across reconciles.
 func newAddrTypePortMapKey(endpointPorts []discovery.EndpointPort, addrType discovery.AddressType) addrTypePortMapKey {
 	pmk := fmt.Sprintf("%s-%s", addrType, endpointsliceutil.NewPortMapKey(endpointPorts))
 	return addrTypePortMapKey(pmk)
 }
 
 func (pk addrTypePortMapKey) addressType() discovery.AddressType {
-	if strings.HasPrefix(string(pk), string(discovery.AddressTypeIPv6)) {
-		return discovery.AddressTypeIPv6
+	// The port map hash never contains "-", so everything before the last "-"
+	// is the address type, which may be a custom type produced by an
+	// addressTypeResolver.
+	if i := strings.LastIndex(string(pk), "-"); i != -1 {
+		return discovery.AddressType(string(pk)[:i])
 	}
 	return discovery.AddressTypeIPv4
 }
@@ -61,6 +139,64 @@ func getAddressType(address string) *discovery.AddressType {
 	return &addressType
 }
 
+// latestFinishedAt returns the most recent time a container of the pod
+// finished, or the zero time if none is recorded.
+func latestFinishedAt(pod *corev1.Pod) metav1.Time {
+	var finished metav1.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && finished.Before(&status.State.Terminated.FinishedAt) {
+			finished = status.State.Terminated.FinishedAt
+		}
+	}
+	return finished
+}
+
+// shardForKey deterministically maps a queue key to one of shards workers so
+// that the same key is always handled by the same worker.
+func shardForKey(key string, shards int) int {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+	return int(hasher.Sum32() % uint32(shards))
+}
+
+// canonicalAddress returns the canonical string form of an IP address, or an
+// empty string if the address cannot be parsed.
+func canonicalAddress(address string) string {
+	ip := netutils.ParseIPSloppy(address)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// canonicalFQDN returns the canonical form of a DNS name: lowercase with any
+// trailing dot stripped. DNS names compare case-insensitively and a trailing
+// dot only marks a name as fully qualified.
+func canonicalFQDN(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// isLocalAddress returns true if the provided IP is a loopback, unspecified,
+// or multicast address. Such addresses are almost never valid backends.
+func isLocalAddress(address string) bool {
+	ip := netutils.ParseIPSloppy(address)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// getSliceHistoryPrefix returns a suitable GenerateName prefix for a retained
+// copy of the named EndpointSlice, falling back to the regular slice prefix
+// when the name would be too long.
+func getSliceHistoryPrefix(sliceName, serviceName string) string {
+	prefix := fmt.Sprintf("%s-history-", sliceName)
+	if len(validation.ValidateEndpointSliceName(prefix, true)) != 0 {
+		prefix = getEndpointSlicePrefix(serviceName)
+	}
+	return prefix
+}
+
 // newEndpointSlice returns an EndpointSlice generated from an Endpoints
 // resource, ports, and address type.
 func newEndpointSlice(endpoints *corev1.Endpoints, ports []discovery.EndpointPort, addrType discovery.AddressType, sliceName string) *discovery.EndpointSlice {
@@ -104,6 +240,240 @@ func newEndpointSlice(endpoints *corev1.Endpoints, ports []discovery.EndpointPor
 	return epSlice
 }
 
+// sliceContentHash returns a hash of the mirrored content of an
+// EndpointSlice. The hash is independent of the order endpoints and ports
+// are stored in.
+func sliceContentHash(epSlice *discovery.EndpointSlice) string {
+	endpoints := make([]discovery.Endpoint, len(epSlice.Endpoints))
+	copy(endpoints, epSlice.Endpoints)
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Addresses[0] < endpoints[j].Addresses[0]
+	})
+	ports := make([]discovery.EndpointPort, len(epSlice.Ports))
+	copy(ports, epSlice.Ports)
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Name != nil && ports[j].Name != nil && *ports[i].Name != *ports[j].Name {
+			return *ports[i].Name < *ports[j].Name
+		}
+		return ports[i].Port != nil && ports[j].Port != nil && *ports[i].Port < *ports[j].Port
+	})
+
+	hasher := fnv.New32a()
+	hashutil.DeepHashObject(hasher, struct {
+		AddressType discovery.AddressType
+		Ports       []discovery.EndpointPort
+		Endpoints   []discovery.Endpoint
+	}{epSlice.AddressType, ports, endpoints})
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// sortSliceEndpoints sorts the endpoints of a generated EndpointSlice, and
+// the addresses within each endpoint, so repeated reconciles of the same
+// content emit byte-identical slices.
+func sortSliceEndpoints(epSlice *discovery.EndpointSlice) {
+	for i := range epSlice.Endpoints {
+		sort.Strings(epSlice.Endpoints[i].Addresses)
+	}
+	sort.Slice(epSlice.Endpoints, func(i, j int) bool {
+		return epSlice.Endpoints[i].Addresses[0] < epSlice.Endpoints[j].Addresses[0]
+	})
+}
+
+// desiredContentHash returns the content hash an EndpointSlice holding the
+// desired endpoints for a port mapping would carry, allowing a stored hash to
+// be compared against the desired state without generating a slice.
+func desiredContentHash(addressType discovery.AddressType, ports []discovery.EndpointPort, desiredSet endpointsliceutil.EndpointSet) string {
+	epSlice := &discovery.EndpointSlice{
+		AddressType: addressType,
+		Ports:       ports,
+	}
+	for _, endpoint := range desiredSet.UnsortedList() {
+		epSlice.Endpoints = append(epSlice.Endpoints, *endpoint)
+	}
+	return sliceContentHash(epSlice)
+}
+
+// parseEndpointWeights returns the per-address weights encoded in the weights
+// annotation of an Endpoints resource, or nil if the annotation is absent or
+// malformed. Weights are keyed by address in canonical form.
+func parseEndpointWeights(endpoints *corev1.Endpoints) map[string]int32 {
+	raw, ok := endpoints.Annotations[endpointWeightsAnnotation]
+	if !ok {
+		return nil
+	}
+	weights := map[string]int32{}
+	if err := json.Unmarshal([]byte(raw), &weights); err != nil {
+		return nil
+	}
+	return weights
+}
+
+// endpointWeightsValue returns the weights annotation value for a slice: the
+// given weights filtered down to the addresses present in the slice, in a
+// deterministic encoding. It returns "" if no address in the slice has a
+// weight.
+func endpointWeightsValue(weights map[string]int32, epSlice *discovery.EndpointSlice) string {
+	if len(weights) == 0 {
+		return ""
+	}
+	sliceWeights := map[string]int32{}
+	for _, endpoint := range epSlice.Endpoints {
+		for _, address := range endpoint.Addresses {
+			if weight, ok := weights[address]; ok {
+				sliceWeights[address] = weight
+			}
+		}
+	}
+	if len(sliceWeights) == 0 {
+		return ""
+	}
+	// Marshal sorts map keys, keeping the encoding deterministic.
+	value, err := json.Marshal(sliceWeights)
+	if err != nil {
+		return ""
+	}
+	return string(value)
+}
+
+// applyEndpointWeights sets the weights annotation of a generated slice to the
+// weights of the endpoints it holds, replacing the full map mirrored from the
+// Endpoints annotations.
+func applyEndpointWeights(weights map[string]int32, epSlice *discovery.EndpointSlice) {
+	if value := endpointWeightsValue(weights, epSlice); value != "" {
+		epSlice.Annotations[endpointWeightsAnnotation] = value
+	} else {
+		delete(epSlice.Annotations, endpointWeightsAnnotation)
+	}
+}
+
+// stableSliceIdentifier returns a deterministic identifier for the
+// EndpointSlice mirrored from an Endpoints resource for one address type and
+// port mapping. The identifier is independent of the slice name and UID, so
+// it is stable across a delete and recreate of the slice.
+func stableSliceIdentifier(endpoints *corev1.Endpoints, ports []discovery.EndpointPort, addrType discovery.AddressType) string {
+	hasher := fnv.New32a()
+	hashutil.DeepHashObject(hasher, struct {
+		Namespace string
+		Name      string
+		Key       addrTypePortMapKey
+	}{endpoints.Namespace, endpoints.Name, newAddrTypePortMapKey(ports, addrType)})
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// stampContentGeneration sets the content hash and generation annotations on
+// a generated EndpointSlice. The generation carries over from the existing
+// slice and increments only when the content hash changes.
+func stampContentGeneration(newSlice, existingSlice *discovery.EndpointSlice) {
+	contentHash := sliceContentHash(newSlice)
+	generation := int64(1)
+	if existingSlice != nil {
+		existingGeneration, err := strconv.ParseInt(existingSlice.Annotations[contentGenerationAnnotation], 10, 64)
+		if err == nil {
+			generation = existingGeneration
+			if existingSlice.Annotations[contentHashAnnotation] != contentHash {
+				generation++
+			}
+		}
+	}
+	newSlice.Annotations[contentHashAnnotation] = contentHash
+	newSlice.Annotations[contentGenerationAnnotation] = strconv.FormatInt(generation, 10)
+}
+
+// splitPortsBySliceLimit splits a subset's ports into groups no larger than
+// maxPortsPerSlice so that each group can be mirrored to its own
+// EndpointSlice.
+func splitPortsBySliceLimit(ports []corev1.EndpointPort) [][]corev1.EndpointPort {
+	if len(ports) <= maxPortsPerSlice {
+		return [][]corev1.EndpointPort{ports}
+	}
+	var groups [][]corev1.EndpointPort
+	for start := 0; start < len(ports); start += maxPortsPerSlice {
+		end := start + maxPortsPerSlice
+		if end > len(ports) {
+			end = len(ports)
+		}
+		groups = append(groups, ports[start:end])
+	}
+	return groups
+}
+
+// targetSlices returns the number of EndpointSlices requested by the
+// target-slices annotation on an Endpoints resource. It returns 0 if the
+// annotation is not set or cannot be parsed.
+func targetSlices(endpoints *corev1.Endpoints) int {
+	val, ok := endpoints.Annotations[targetSlicesAnnotation]
+	if !ok {
+		return 0
+	}
+	target, err := strconv.Atoi(val)
+	if err != nil || target < 1 {
+		return 0
+	}
+	return target
+}
+
+// sliceByteBudget returns the per-slice byte budget requested by the
+// slice-byte-budget annotation on an Endpoints resource. It returns 0 if the
+// annotation is not set or cannot be parsed.
+func sliceByteBudget(endpoints *corev1.Endpoints) int {
+	val, ok := endpoints.Annotations[sliceByteBudgetAnnotation]
+	if !ok {
+		return 0
+	}
+	budget, err := strconv.Atoi(val)
+	if err != nil || budget < 1 {
+		return 0
+	}
+	return budget
+}
+
+// endpointOverheadBytes approximates the serialized size of an endpoint's
+// fixed fields: conditions, the TargetRef, and surrounding structure.
+const endpointOverheadBytes = 100
+
+// estimateEndpointSize returns a conservative estimate of the serialized
+// size of an endpoint in bytes.
+func estimateEndpointSize(endpoint *discovery.Endpoint) int {
+	size := endpointOverheadBytes
+	for _, address := range endpoint.Addresses {
+		size += len(address)
+	}
+	if endpoint.Hostname != nil {
+		size += len(*endpoint.Hostname)
+	}
+	if endpoint.TargetRef != nil {
+		size += len(endpoint.TargetRef.Namespace) + len(endpoint.TargetRef.Name)
+	}
+	return size
+}
+
+const (
+	// sliceOverheadBytes approximates the serialized size of an
+	// EndpointSlice's fields outside its endpoints and ports: metadata,
+	// labels, annotations, and surrounding structure.
+	sliceOverheadBytes = 500
+	// portOverheadBytes approximates the serialized size of an EndpointPort's
+	// fixed fields.
+	portOverheadBytes = 50
+)
+
+// estimateSliceSize returns a conservative estimate of the serialized size of
+// an EndpointSlice in bytes, so slices approaching the apiserver object size
+// limit can be identified.
+func estimateSliceSize(epSlice *discovery.EndpointSlice) int {
+	size := sliceOverheadBytes
+	for i := range epSlice.Endpoints {
+		size += estimateEndpointSize(&epSlice.Endpoints[i])
+	}
+	for _, port := range epSlice.Ports {
+		size += portOverheadBytes
+		if port.Name != nil {
+			size += len(*port.Name)
+		}
+	}
+	return size
+}
+
 // getEndpointSlicePrefix returns a suitable prefix for an EndpointSlice name.
 func getEndpointSlicePrefix(serviceName string) string {
 	// use the dash (if the name isn't too long) to make the name a bit prettier.
@@ -135,6 +505,25 @@ func addressToEndpoint(address corev1.EndpointAddress, ready bool) *discovery.En
 	return endpoint
 }
 
+// preserveEndpointHints copies endpoint Hints from a live EndpointSlice to a
+// regenerated slice, matching endpoints by their first address.
+func preserveEndpointHints(newSlice, existingSlice *discovery.EndpointSlice) {
+	hintsByIP := map[string]*discovery.EndpointHints{}
+	for _, endpoint := range existingSlice.Endpoints {
+		if endpoint.Hints != nil && len(endpoint.Addresses) > 0 {
+			hintsByIP[endpoint.Addresses[0]] = endpoint.Hints
+		}
+	}
+	for i := range newSlice.Endpoints {
+		if len(newSlice.Endpoints[i].Addresses) == 0 {
+			continue
+		}
+		if hints, ok := hintsByIP[newSlice.Endpoints[i].Addresses[0]]; ok {
+			newSlice.Endpoints[i].Hints = hints.DeepCopy()
+		}
+	}
+}
+
 // epPortsToEpsPorts converts ports from an Endpoints resource to ports for an
 // EndpointSlice resource.
 func epPortsToEpsPorts(epPorts []corev1.EndpointPort) []discovery.EndpointPort {
@@ -240,6 +629,15 @@ func hasLeaderElection(annotations map[string]string) bool {
 	return ok
 }
 
+// markSliceTruncated annotates an EndpointSlice as belonging to a truncated
+// set.
+func markSliceTruncated(epSlice *discovery.EndpointSlice) {
+	if epSlice.Annotations == nil {
+		epSlice.Annotations = map[string]string{}
+	}
+	epSlice.Annotations[truncatedAnnotation] = "true"
+}
+
 // cloneAndRemoveKeys is a copy of CloneAndRemoveLabels
 // it is used here for annotations and labels
 func cloneAndRemoveKeys(a map[string]string, keys ...string) map[string]string {